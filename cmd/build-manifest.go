@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// buildManifestFile is the name of the manifest written to the output folder
+const buildManifestFile = ".gigsheets-manifest.json"
+
+// buildManifestVersion must be changed if the manifest format or what it records changes
+const buildManifestVersion = 1
+
+// buildManifest records the inputs each PDF in an output folder was generated from,
+// so that PDFs whose inputs have not changed can be skipped
+type buildManifest struct {
+	Version int                      `json:"version"`
+	Salt    string                   `json:"salt"`    // Random key for the HMAC of PDF passwords, different for every output folder
+	Outputs map[string]manifestEntry `json:"outputs"` // Keyed by PDF path relative to the output folder
+
+	dir        string            // Output folder the manifest belongs to
+	fileHashes map[string]string // Hashes of files read during this run, by path
+}
+
+// manifestEntry is the set of inputs a single PDF was generated from. Paths are relative
+// to the output folder.
+type manifestEntry struct {
+	GigsheetsVersion string            `json:"gigsheetsVersion"`
+	GigFile          string            `json:"gigFile"`
+	GigHash          string            `json:"gigHash"`
+	ConfigHash       string            `json:"configHash"` // Hash of the config and flags that affect this PDF
+	Images           map[string]string `json:"images"`     // Image path to content hash
+}
+
+// loadBuildManifest reads the manifest in outputDir. A missing manifest is empty, and an
+// unreadable one is reported and treated as empty so that everything is regenerated.
+func loadBuildManifest(outputDir string) *buildManifest {
+	manifest := &buildManifest{
+		Version:    buildManifestVersion,
+		Salt:       rand.Text(),
+		Outputs:    make(map[string]manifestEntry),
+		dir:        outputDir,
+		fileHashes: make(map[string]string),
+	}
+
+	data, err := os.ReadFile(filepath.Join(outputDir, buildManifestFile))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Printf("Warning: could not read build manifest, regenerating all PDFs: %v\n", err)
+		}
+		return manifest
+	}
+
+	var saved buildManifest
+	if err := json.Unmarshal(data, &saved); err != nil {
+		fmt.Printf("Warning: could not parse build manifest, regenerating all PDFs: %v\n", err)
+		return manifest
+	}
+	if saved.Version == buildManifestVersion && saved.Outputs != nil {
+		manifest.Outputs = saved.Outputs
+		// Manifests without a salt keep the new one, so protected PDFs are regenerated once
+		if saved.Salt != "" {
+			manifest.Salt = saved.Salt
+		}
+	}
+	return manifest
+}
+
+// save writes the manifest, dropping entries for PDFs that no longer exist
+func (m *buildManifest) save() error {
+	for outputPath := range m.Outputs {
+		if _, err := os.Stat(filepath.Join(m.dir, filepath.FromSlash(outputPath))); os.IsNotExist(err) {
+			delete(m.Outputs, outputPath)
+		}
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal build manifest: %w", err)
+	}
+
+	// Write to a temporary file and rename so that an interrupted run never leaves a partial manifest
+	tmp, err := os.CreateTemp(m.dir, buildManifestFile+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write build manifest: %w", err)
+	}
+	tmpName := tmp.Name()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmpName)
+		return fmt.Errorf("failed to write build manifest: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmpName)
+		return fmt.Errorf("failed to write build manifest: %w", err)
+	}
+	if err := os.Rename(tmpName, filepath.Join(m.dir, buildManifestFile)); err != nil {
+		_ = os.Remove(tmpName)
+		return fmt.Errorf("failed to write build manifest: %w", err)
+	}
+	return nil
+}
+
+// entryFor records the current inputs of the PDF for gig
+func (m *buildManifest) entryFor(config *Config, gig *Gig, gigFile string, songMap map[string]map[string]string, opts *renderOptions) manifestEntry {
+	entry := manifestEntry{
+		GigsheetsVersion: Version,
+		GigFile:          m.relativePath(gigFile),
+		GigHash:          m.hashFile(gigFile),
+		Images:           make(map[string]string),
+	}
+
+	// Only the parts of the config used by this gig, so editing one song does not rebuild every PDF
+	var settings strings.Builder
+	for _, songRef := range gigSongRefs(gig) {
+		imagePath, err := resolveSongImage(songMap, songRef, opts.imageOverride, opts.imagesDir)
+		if err != nil {
+			fmt.Fprintf(&settings, "song %s: %v\n", songRef, err)
+			continue
+		}
+		fmt.Fprintf(&settings, "song %s: %s %s\n", songRef, m.relativePath(imagePath), opts.settingsFor(songMap, songRef).key(""))
+		entry.Images[m.relativePath(imagePath)] = m.hashFile(imagePath)
+	}
+	fmt.Fprintf(&settings, "spacing: %g\n", opts.spacing)
+	fmt.Fprintf(&settings, "metadata: %+v\n", gigMetadata(config, gig))
+	fmt.Fprintf(&settings, "watermark: %+v\n", opts.watermark)
+	if opts.protection != nil {
+		fmt.Fprintf(&settings, "protection: actions=%d passwords=%s\n", opts.protection.actionFlag, m.passwordsHash(opts.protection))
+	}
+	fmt.Fprintf(&settings, "maxSize: %d\n", opts.maxSize)
+	fmt.Fprintf(&settings, "draft: %t\n", opts.draft)
+	fmt.Fprintf(&settings, "theme: %s\n", opts.theme.name)
+	fmt.Fprintf(&settings, "largePrint: %t %g\n", opts.largePrint, opts.textScale)
+	if opts.profile != nil {
+		fmt.Fprintf(&settings, "profile: %+v\n", *opts.profile)
+	}
+
+	sum := sha256.Sum256([]byte(settings.String()))
+	entry.ConfigHash = hex.EncodeToString(sum[:])
+	return entry
+}
+
+// passwordsHash returns an HMAC of the PDF passwords keyed with the manifest's salt, so that
+// changing a password regenerates the PDF. The manifest sits next to the PDFs, so a plain hash
+// could be looked up in precomputed tables of common passwords.
+func (m *buildManifest) passwordsHash(protection *pdfProtection) string {
+	mac := hmac.New(sha256.New, []byte(m.Salt))
+	mac.Write([]byte(protection.userPassword))
+	mac.Write([]byte{0})
+	mac.Write([]byte(protection.ownerPassword))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// upToDate reports whether outputFile exists and was generated from the same inputs as entry
+func (m *buildManifest) upToDate(outputFile string, entry manifestEntry) bool {
+	if _, err := os.Stat(outputFile); err != nil {
+		return false
+	}
+
+	previous, exists := m.Outputs[m.relativePath(outputFile)]
+	return exists &&
+		previous.GigsheetsVersion == entry.GigsheetsVersion &&
+		previous.GigFile == entry.GigFile &&
+		previous.GigHash == entry.GigHash &&
+		previous.ConfigHash == entry.ConfigHash &&
+		maps.Equal(previous.Images, entry.Images)
+}
+
+// record stores the inputs outputFile was generated from
+func (m *buildManifest) record(outputFile string, entry manifestEntry) {
+	m.Outputs[m.relativePath(outputFile)] = entry
+}
+
+// forget removes outputFile, e.g. after it failed to generate
+func (m *buildManifest) forget(outputFile string) {
+	delete(m.Outputs, m.relativePath(outputFile))
+}
+
+// hashFile returns the SHA-256 of a file's contents, or "missing" if it cannot be read.
+// Each file is read at most once per run.
+func (m *buildManifest) hashFile(path string) string {
+	if hash, exists := m.fileHashes[path]; exists {
+		return hash
+	}
+
+	hash := "missing"
+	if data, err := os.ReadFile(path); err == nil {
+		sum := sha256.Sum256(data)
+		hash = hex.EncodeToString(sum[:])
+	}
+	m.fileHashes[path] = hash
+	return hash
+}
+
+// relativePath returns path relative to the output folder with forward slashes,
+// so the manifest does not depend on the working directory
+func (m *buildManifest) relativePath(path string) string {
+	absDir, errDir := filepath.Abs(m.dir)
+	absPath, errPath := filepath.Abs(path)
+	if errDir == nil && errPath == nil {
+		if rel, err := filepath.Rel(absDir, absPath); err == nil {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.ToSlash(path)
+}
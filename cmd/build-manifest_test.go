@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildManifestPasswordChangeIsStale(t *testing.T) {
+	dir := t.TempDir()
+	gigFile := filepath.Join(dir, "friday.yaml")
+	writeTestFile(t, gigFile, "name: Friday\n")
+	outputFile := filepath.Join(dir, "friday.pdf")
+	writeTestFile(t, outputFile, "%PDF")
+
+	config := &Config{}
+	gig := &Gig{Name: "Friday"}
+	entryFor := func(manifest *buildManifest, userPassword string) manifestEntry {
+		opts := &renderOptions{protection: &pdfProtection{userPassword: userPassword, ownerPassword: "owner"}}
+		return manifest.entryFor(config, gig, gigFile, nil, opts)
+	}
+
+	manifest := loadBuildManifest(dir)
+	manifest.record(outputFile, entryFor(manifest, "first"))
+	if err := manifest.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, buildManifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "first") || strings.Contains(string(data), "owner") {
+		t.Errorf("the manifest contains a password:\n%s", data)
+	}
+
+	manifest = loadBuildManifest(dir)
+	if !manifest.upToDate(outputFile, entryFor(manifest, "first")) {
+		t.Error("the PDF is stale, but its password has not changed")
+	}
+	if manifest.upToDate(outputFile, entryFor(manifest, "second")) {
+		t.Error("the PDF is up to date, but its password has changed")
+	}
+}
+
+func TestBuildManifestSaltDiffersBetweenFolders(t *testing.T) {
+	protection := &pdfProtection{userPassword: "secret"}
+	first := loadBuildManifest(t.TempDir())
+	second := loadBuildManifest(t.TempDir())
+	if first.Salt == second.Salt || first.passwordsHash(protection) == second.passwordsHash(protection) {
+		t.Error("two new manifests have the same salt or password hash")
+	}
+}
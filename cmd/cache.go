@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"gigsheets/internal/pkg/imagecache"
+
+	"github.com/spf13/cobra"
+)
+
+var cacheConfigFile string
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the cache of cropped images",
+	Long: `Manage the on-disk cache of cropped images used by generate.
+The cache is stored in the cacheFolder from the config file if set, otherwise in ~/.gigsheets/cache
+(or the folder in the GIGSHEETS_CACHE_PATH environment variable).`,
+}
+
+var cacheStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show the number and size of cached images",
+	Run:   runCacheStats,
+}
+
+var cacheCleanCmd = &cobra.Command{
+	Use:   "clean",
+	Short: "Remove all cached images",
+	Run:   runCacheClean,
+}
+
+func init() {
+	cacheCmd.PersistentFlags().StringVarP(&cacheConfigFile, "config", "c", "config.yaml", "Path to config YAML file (used to find cacheFolder if set)")
+	cacheCmd.AddCommand(cacheStatsCmd)
+	cacheCmd.AddCommand(cacheCleanCmd)
+}
+
+// resolveCacheCommandCache finds the cache folder, using the config file when it exists.
+// A missing default config.yaml is not an error as the cache may be shared by many configs.
+func resolveCacheCommandCache(cmd *cobra.Command) *imagecache.Cache {
+	config, err := loadConfig(cacheConfigFile)
+	if err != nil {
+		if cmd.Flags().Changed("config") {
+			log.Fatalf("Error loading config file: %v", err)
+		}
+		config = &Config{}
+	}
+
+	return imagecache.New(resolveCacheFolder(config, filepath.Dir(cacheConfigFile)))
+}
+
+func runCacheStats(cmd *cobra.Command, args []string) {
+	imageCache := resolveCacheCommandCache(cmd)
+
+	stats, err := imageCache.Stats()
+	if err != nil {
+		log.Fatalf("Error reading cache: %v", err)
+	}
+
+	fmt.Printf("Cache folder: %s\n", imageCache.Dir())
+	fmt.Printf("Entries:      %d\n", stats.Entries)
+	fmt.Printf("Size:         %s\n", formatBytes(stats.Bytes))
+	if stats.Entries > 0 {
+		fmt.Printf("Oldest entry: %s\n", stats.Oldest.Format("2006-01-02 15:04:05"))
+		fmt.Printf("Newest entry: %s\n", stats.Newest.Format("2006-01-02 15:04:05"))
+	}
+}
+
+func runCacheClean(cmd *cobra.Command, args []string) {
+	imageCache := resolveCacheCommandCache(cmd)
+
+	removed, err := imageCache.Clean()
+	if err != nil {
+		fmt.Printf("Removed %d cached images before error\n", removed)
+		log.Printf("Error cleaning cache: %v", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Removed %d cached images from %s\n", removed, imageCache.Dir())
+}
+
+// formatBytes formats a byte count for display, e.g. "12.3 MB"
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"image"
+
+	"golang.org/x/image/draw"
+)
+
+// blankBand is a run of blank rows in an image, from start up to but not including end
+type blankBand struct {
+	start, end int
+}
+
+// findBlankBands finds the runs of blank rows taller than minHeight between the content of img.
+// Rows are classified with the same pixel scan and settings as cropping, so in tolerant mode rows
+// with only a few specks are blank too. Bands touching the top or bottom edge (such as crop
+// padding) are not included.
+func findBlankBands(img image.Image, crop cropSettings, minHeight int) []blankBand {
+	bounds := img.Bounds()
+	rowCounts, _ := contentProfiles(bounds, newContentTest(img, crop.threshold))
+	noise := 0
+	if crop.mode == cropModeTolerant {
+		noise = noiseLevel(crop.noiseSize, bounds.Dx())
+	}
+
+	var bands []blankBand
+	start := -1 // Start of the current run of blank rows, or -1 if the last row had content
+	seenContent := false
+	for i, count := range rowCounts {
+		if count <= noise {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if seenContent && start >= 0 && i-start > minHeight {
+			bands = append(bands, blankBand{start: bounds.Min.Y + start, end: bounds.Min.Y + i})
+		}
+		seenContent = true
+		start = -1
+	}
+	return bands
+}
+
+// compactImage collapses the tall blank bands inside img to the configured gap, so that large
+// gaps between the sections of a chart do not waste space on the page. The middle of each band
+// is removed, keeping its top and bottom edges so the background is unchanged. Lengths in mm
+// are measured on the page, at the scale the image is shown at.
+func compactImage(img image.Image, songName string, settings imageSettings, out *jobOutput) image.Image {
+	compact := settings.compact
+	if !compact.enabled {
+		return img
+	}
+
+	bounds := img.Bounds()
+	mmPerPixel := settings.shownWidthMM(bounds.Dx()) / float64(bounds.Dx())
+	if mmPerPixel <= 0 {
+		mmPerPixel = 25.4 / 72 // The page width is not known, e.g. when validating the config
+	}
+	minHeightPx := compact.minHeight.pixels(mmPerPixel)
+	gapPx := min(compact.gap.pixels(mmPerPixel), minHeightPx)
+
+	bands := findBlankBands(img, settings.crop, minHeightPx)
+	if len(bands) == 0 {
+		if debugMode {
+			out.Logf("[DEBUG] Image '%s' - no blank bands taller than %dpx to compact", songName, minHeightPx)
+		}
+		return img
+	}
+
+	removed := 0
+	for _, band := range bands {
+		removed += band.end - band.start - gapPx
+	}
+	compacted := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()-removed))
+
+	destY := 0
+	copyRows := func(from, to int) {
+		draw.Copy(compacted, image.Pt(0, destY), img, image.Rect(bounds.Min.X, from, bounds.Max.X, to), draw.Src, nil)
+		destY += to - from
+	}
+	from := bounds.Min.Y
+	for _, band := range bands {
+		keepTop := gapPx / 2
+		copyRows(from, band.start+keepTop)
+		from = band.end - (gapPx - keepTop)
+	}
+	copyRows(from, bounds.Max.Y)
+
+	if debugMode {
+		out.Logf("[DEBUG] Image '%s' - collapsed %d blank band(s) to %dpx: height %d -> %d",
+			songName, len(bands), gapPx, bounds.Dy(), compacted.Bounds().Dy())
+	}
+	return compacted
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"image"
+	"testing"
+)
+
+// newBandedImage returns a white image of the given width with black content rows between
+// blank bands of the given heights in pixels
+func newBandedImage(width int, contentHeight int, bandHeights ...int) *image.Gray {
+	height := contentHeight * (len(bandHeights) + 1)
+	for _, band := range bandHeights {
+		height += band
+	}
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+
+	y := 0
+	for i := 0; i <= len(bandHeights); i++ {
+		for row := y; row < y+contentHeight; row++ {
+			for x := 0; x < width; x++ {
+				img.Pix[img.PixOffset(x, row)] = 0
+			}
+		}
+		y += contentHeight
+		if i < len(bandHeights) {
+			y += bandHeights[i]
+		}
+	}
+	return img
+}
+
+func TestCompactImageMeasuresMillimetresOnThePage(t *testing.T) {
+	settings := imageSettings{displayWidthMM: 190, crop: defaultCropSettings(), compact: defaultCompactSettings()}
+	settings.compact.enabled = true
+
+	for _, test := range []struct {
+		name       string
+		width      int
+		bands      []int // Blank bands: about 12mm and 8mm on the page
+		wantHeight int
+	}{
+		// 400px at 72 DPI is 141mm, narrower than the page, so it is shown at its natural size:
+		// 10mm is 28px and 3mm is 9px
+		{"natural size", 400, []int{34, 23}, 3*100 + 9 + 23},
+		// A 600 DPI scan 4800px wide is shown 190mm wide, so 10mm is 253px and 3mm is 76px. At
+		// 72 DPI both bands would be taller than 10mm and collapsed to 9px.
+		{"600 DPI scan", 4800, []int{300, 200}, 3*100 + 76 + 200},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			img := newBandedImage(test.width, 100, test.bands...)
+			compacted := compactImage(img, "chart", settings, directOutput())
+			if got := compacted.Bounds().Dy(); got != test.wantHeight {
+				t.Errorf("compacted height = %d, want %d", got, test.wantHeight)
+			}
+		})
+	}
+}
+
+func TestCompactImageGapInPixels(t *testing.T) {
+	settings := imageSettings{displayWidthMM: 190, crop: defaultCropSettings(), compact: defaultCompactSettings()}
+	enabled := true
+	compact, err := settings.compact.apply(&CompactConfig{Enabled: &enabled, MinHeight: "100px", Gap: "20px"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings.compact = compact
+
+	img := newBandedImage(4800, 100, 150, 80)
+	compacted := compactImage(img, "chart", settings, directOutput())
+	if got, want := compacted.Bounds().Dy(), 3*100+20+80; got != want {
+		t.Errorf("compacted height = %d, want %d", got, want)
+	}
+}
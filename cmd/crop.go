@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"image"
+	"image/color"
+)
+
+// defaultBackgroundThreshold is the default minimum value of each 8-bit colour channel for a
+// pixel to count as white
+const defaultBackgroundThreshold = 240
+
+// contentTest reports whether the pixel at (x, y) is content, i.e. neither white nor transparent.
+// It gives the same answer as !isWhiteOrTransparent(img.At(x, y), threshold).
+type contentTest func(x, y int) bool
+
+// newContentTest returns a contentTest that reads the pixel buffer directly for the common
+// decoded image types, avoiding the color.Color interface, and falls back to img.At otherwise
+func newContentTest(img image.Image, threshold uint8) contentTest {
+	t := threshold
+
+	switch src := img.(type) {
+	case *image.Gray:
+		return func(x, y int) bool {
+			return src.Pix[src.PixOffset(x, y)] < t
+		}
+
+	case *image.RGBA:
+		// Already alpha-premultiplied, matching color.Color.RGBA()
+		return func(x, y int) bool {
+			i := src.PixOffset(x, y)
+			p := src.Pix[i : i+4 : i+4]
+			if p[3] == 0 {
+				return false
+			}
+			return p[0] < t || p[1] < t || p[2] < t
+		}
+
+	case *image.NRGBA:
+		return func(x, y int) bool {
+			i := src.PixOffset(x, y)
+			p := src.Pix[i : i+4 : i+4]
+			a := uint32(p[3])
+			if a == 0 {
+				return false
+			}
+			// Premultiply exactly as color.NRGBA.RGBA() does, then take the high byte
+			return premultiplied8(p[0], a) < t || premultiplied8(p[1], a) < t || premultiplied8(p[2], a) < t
+		}
+
+	case *image.YCbCr:
+		return func(x, y int) bool {
+			c := color.YCbCr{Y: src.Y[src.YOffset(x, y)], Cb: src.Cb[src.COffset(x, y)], Cr: src.Cr[src.COffset(x, y)]}
+			r, g, b, _ := c.RGBA()
+			return uint8(r>>8) < t || uint8(g>>8) < t || uint8(b>>8) < t
+		}
+
+	case *image.Paletted:
+		// Classify each palette entry once
+		isContent := make([]bool, 256)
+		for i, c := range src.Palette {
+			isContent[i] = !isWhiteOrTransparent(c, t)
+		}
+		return func(x, y int) bool {
+			return isContent[src.Pix[src.PixOffset(x, y)]]
+		}
+	}
+
+	return func(x, y int) bool {
+		return !isWhiteOrTransparent(img.At(x, y), t)
+	}
+}
+
+func premultiplied8(v uint8, a uint32) uint8 {
+	c := uint32(v)
+	c |= c << 8
+	c *= a
+	c /= 0xff
+	return uint8(c >> 8)
+}
+
+// findContentBounds returns the smallest rectangle containing every content pixel, and false
+// if the image has no content at all. Rows are scanned in memory order: the top and bottom
+// content rows are found first, then each row between them is only scanned outside the
+// left/right extent found so far, so most pixels inside the content area are never read.
+func findContentBounds(img image.Image, threshold uint8) (image.Rectangle, bool) {
+	bounds := img.Bounds()
+	isContent := newContentTest(img, threshold)
+
+	// rowExtent returns the first and last content columns in row y, or false if there are none
+	rowExtent := func(y int) (int, int, bool) {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if isContent(x, y) {
+				last := x
+				for xr := bounds.Max.X - 1; xr > x; xr-- {
+					if isContent(xr, y) {
+						last = xr
+						break
+					}
+				}
+				return x, last, true
+			}
+		}
+		return 0, 0, false
+	}
+
+	// Scan from the top for the first content row
+	top := bounds.Min.Y
+	left, right := 0, 0
+	found := false
+	for ; top < bounds.Max.Y; top++ {
+		if left, right, found = rowExtent(top); found {
+			break
+		}
+	}
+	if !found {
+		return bounds, false
+	}
+
+	// Scan from the bottom for the last content row (which must exist)
+	bottom := bounds.Max.Y - 1
+	for ; bottom > top; bottom-- {
+		if rowLeft, rowRight, ok := rowExtent(bottom); ok {
+			left = min(left, rowLeft)
+			right = max(right, rowRight)
+			break
+		}
+	}
+
+	// Widen the left/right extent using the rows in between, only looking outside it
+	for y := top + 1; y < bottom; y++ {
+		for x := bounds.Min.X; x < left; x++ {
+			if isContent(x, y) {
+				left = x
+				break
+			}
+		}
+		for x := bounds.Max.X - 1; x > right; x-- {
+			if isContent(x, y) {
+				right = x
+				break
+			}
+		}
+	}
+
+	return image.Rect(left, top, right+1, bottom+1), true
+}
+
+// findContentBoundsTolerant is like findContentBounds, but ignores dust specks and dark scanner
+// borders. Dark strips along the edges (rows or columns that are at least half content, up to a
+// tenth of the image) are trimmed first. Then, within what is left, rows and columns with no more
+// than noiseSize content pixels count as blank; if noiseSize is 0 it is chosen from the image size.
+func findContentBoundsTolerant(img image.Image, threshold uint8, noiseSize int) (image.Rectangle, bool) {
+	bounds := img.Bounds()
+	isContent := newContentTest(img, threshold)
+
+	// Trim dark borders from each edge
+	rowCounts, colCounts := contentProfiles(bounds, isContent)
+	inner := bounds
+	maxRows, maxCols := bounds.Dy()/10, bounds.Dx()/10
+	for inner.Min.Y < bounds.Min.Y+maxRows && rowCounts[inner.Min.Y-bounds.Min.Y]*2 >= bounds.Dx() {
+		inner.Min.Y++
+	}
+	for inner.Max.Y > bounds.Max.Y-maxRows && rowCounts[inner.Max.Y-1-bounds.Min.Y]*2 >= bounds.Dx() {
+		inner.Max.Y--
+	}
+	for inner.Min.X < bounds.Min.X+maxCols && colCounts[inner.Min.X-bounds.Min.X]*2 >= bounds.Dy() {
+		inner.Min.X++
+	}
+	for inner.Max.X > bounds.Max.X-maxCols && colCounts[inner.Max.X-1-bounds.Min.X]*2 >= bounds.Dy() {
+		inner.Max.X--
+	}
+
+	// Count again without the borders, which would otherwise add to every row and column
+	if inner != bounds {
+		rowCounts, colCounts = contentProfiles(inner, isContent)
+	}
+
+	rowNoise, colNoise := noiseLevel(noiseSize, inner.Dx()), noiseLevel(noiseSize, inner.Dy())
+
+	content := image.Rectangle{Min: inner.Max, Max: inner.Min}
+	for i, count := range rowCounts {
+		if count > rowNoise {
+			content.Min.Y = min(content.Min.Y, inner.Min.Y+i)
+			content.Max.Y = max(content.Max.Y, inner.Min.Y+i+1)
+		}
+	}
+	for i, count := range colCounts {
+		if count > colNoise {
+			content.Min.X = min(content.Min.X, inner.Min.X+i)
+			content.Max.X = max(content.Max.X, inner.Min.X+i+1)
+		}
+	}
+
+	if content.Empty() {
+		return bounds, false
+	}
+	return content, true
+}
+
+// noiseLevel returns the most content pixels a row or column of length pixels can have and still
+// count as blank in tolerant mode: noiseSize if set, otherwise 0.2% of the length (at least 2)
+func noiseLevel(noiseSize int, length int) int {
+	if noiseSize > 0 {
+		return noiseSize
+	}
+	return max(2, length/500)
+}
+
+// contentProfiles counts the content pixels in each row and each column of area
+func contentProfiles(area image.Rectangle, isContent contentTest) ([]int, []int) {
+	rowCounts := make([]int, area.Dy())
+	colCounts := make([]int, area.Dx())
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			if isContent(x, y) {
+				rowCounts[y-area.Min.Y]++
+				colCounts[x-area.Min.X]++
+			}
+		}
+	}
+	return rowCounts, colCounts
+}
@@ -0,0 +1,256 @@
+package cmd
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+// referenceContentBounds finds the content bounds the slow way, testing every pixel through
+// img.At, as findContentBounds did before it read pixel buffers directly
+func referenceContentBounds(img image.Image, threshold uint8) (image.Rectangle, bool) {
+	bounds := img.Bounds()
+	var content image.Rectangle
+	found := false
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if isWhiteOrTransparent(img.At(x, y), threshold) {
+				continue
+			}
+			pixel := image.Rect(x, y, x+1, y+1)
+			if found {
+				content = content.Union(pixel)
+			} else {
+				content, found = pixel, true
+			}
+		}
+	}
+	if !found {
+		return bounds, false
+	}
+	return content, true
+}
+
+// randomChannel returns a colour channel value that is usually white, often close to the
+// default threshold on either side, and sometimes anything at all
+func randomChannel(rng *rand.Rand) uint8 {
+	switch rng.Intn(6) {
+	case 0:
+		return uint8(rng.Intn(256))
+	case 1:
+		return defaultBackgroundThreshold - 1
+	case 2:
+		return defaultBackgroundThreshold
+	default:
+		return 255
+	}
+}
+
+// randomImage returns a small image of the given type whose pixels are mostly white, with
+// content and near-white pixels scattered through it. Its bounds do not start at (0, 0).
+func randomImage(rng *rand.Rand, kind string) image.Image {
+	rect := image.Rect(3, 5, 3+1+rng.Intn(40), 5+1+rng.Intn(40))
+	density := rng.Float64() * 0.05
+	if rng.Intn(5) == 0 {
+		density = 0 // Blank images have no content bounds
+	}
+
+	pixel := func() (r, g, b, a uint8) {
+		if rng.Float64() >= density {
+			return 255, 255, 255, 255
+		}
+		a = 255
+		if rng.Intn(4) == 0 {
+			a = uint8(rng.Intn(256))
+		}
+		return randomChannel(rng), randomChannel(rng), randomChannel(rng), a
+	}
+
+	switch kind {
+	case "Gray":
+		img := image.NewGray(rect)
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				r, _, _, _ := pixel()
+				img.SetGray(x, y, color.Gray{Y: r})
+			}
+		}
+		return img
+
+	case "RGBA":
+		img := image.NewRGBA(rect)
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				// RGBA is premultiplied, so no channel may exceed alpha
+				r, g, b, a := pixel()
+				c := color.NRGBA{R: r, G: g, B: b, A: a}
+				img.Set(x, y, color.RGBAModel.Convert(c))
+			}
+		}
+		return img
+
+	case "NRGBA":
+		img := image.NewNRGBA(rect)
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				r, g, b, a := pixel()
+				img.SetNRGBA(x, y, color.NRGBA{R: r, G: g, B: b, A: a})
+			}
+		}
+		return img
+
+	case "YCbCr444", "YCbCr420":
+		ratio := image.YCbCrSubsampleRatio444
+		if kind == "YCbCr420" {
+			ratio = image.YCbCrSubsampleRatio420
+		}
+		img := image.NewYCbCr(rect, ratio)
+		for i := range img.Y {
+			img.Y[i] = 255
+		}
+		for i := range img.Cb {
+			img.Cb[i], img.Cr[i] = 128, 128
+		}
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				r, g, b, _ := pixel()
+				yy, cb, cr := color.RGBToYCbCr(r, g, b)
+				img.Y[img.YOffset(x, y)] = yy
+				img.Cb[img.COffset(x, y)] = cb
+				img.Cr[img.COffset(x, y)] = cr
+			}
+		}
+		return img
+
+	case "Paletted":
+		palette := color.Palette{color.White, color.Transparent}
+		for len(palette) < 16 {
+			r, g, b, a := pixel()
+			palette = append(palette, color.NRGBA{R: r, G: g, B: b, A: a})
+		}
+		img := image.NewPaletted(rect, palette)
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				if rng.Float64() < density {
+					img.SetColorIndex(x, y, uint8(1+rng.Intn(len(palette)-1)))
+				}
+			}
+		}
+		return img
+
+	default: // Gray16 has no fast path, so it tests the img.At fallback
+		img := image.NewGray16(rect)
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				r, _, _, _ := pixel()
+				img.SetGray16(x, y, color.Gray16{Y: uint16(r) << 8})
+			}
+		}
+		return img
+	}
+}
+
+func TestFindContentBoundsMatchesPixelScan(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, kind := range []string{"Gray", "RGBA", "NRGBA", "YCbCr444", "YCbCr420", "Paletted", "Gray16"} {
+		for i := 0; i < 300; i++ {
+			img := randomImage(rng, kind)
+			for _, threshold := range []uint8{defaultBackgroundThreshold, 128, 255} {
+				want, wantFound := referenceContentBounds(img, threshold)
+				got, gotFound := findContentBounds(img, threshold)
+				if got != want || gotFound != wantFound {
+					t.Fatalf("%s image %d (%v), threshold %d: got %v, %t; want %v, %t",
+						kind, i, img.Bounds(), threshold, got, gotFound, want, wantFound)
+				}
+			}
+		}
+	}
+}
+
+// scanWidth and scanHeight are the size of an A4 page scanned at 600 DPI
+const (
+	scanWidth  = 4960
+	scanHeight = 7016
+)
+
+// drawScan calls setInk for the pixels of a synthetic chart: staff lines and note heads inside
+// a 10% margin of white, as on a scanned page
+func drawScan(setInk func(x, y int)) {
+	marginX, marginY := scanWidth/10, scanHeight/10
+	for staff := marginY; staff < scanHeight-marginY; staff += 400 {
+		for line := 0; line < 5; line++ {
+			for y := staff + line*40; y < staff+line*40+4; y++ {
+				for x := marginX; x < scanWidth-marginX; x++ {
+					setInk(x, y)
+				}
+			}
+		}
+		for note := marginX + 100; note < scanWidth-marginX-100; note += 180 {
+			top := staff + (note/180%8)*20
+			for y := top; y < top+36; y++ {
+				for x := note; x < note+48; x++ {
+					setInk(x, y)
+				}
+			}
+		}
+	}
+}
+
+func newScanNRGBA() image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, scanWidth, scanHeight))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	drawScan(func(x, y int) {
+		i := img.PixOffset(x, y)
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2] = 0, 0, 0
+	})
+	return img
+}
+
+func newScanGray() image.Image {
+	img := image.NewGray(image.Rect(0, 0, scanWidth, scanHeight))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	drawScan(func(x, y int) {
+		img.Pix[img.PixOffset(x, y)] = 0
+	})
+	return img
+}
+
+func newScanYCbCr() image.Image {
+	img := image.NewYCbCr(image.Rect(0, 0, scanWidth, scanHeight), image.YCbCrSubsampleRatio420)
+	for i := range img.Y {
+		img.Y[i] = 255
+	}
+	for i := range img.Cb {
+		img.Cb[i], img.Cr[i] = 128, 128
+	}
+	drawScan(func(x, y int) {
+		img.Y[img.YOffset(x, y)] = 0
+	})
+	return img
+}
+
+func BenchmarkFindContentBounds(b *testing.B) {
+	for _, scan := range []struct {
+		name  string
+		image func() image.Image
+	}{
+		{"NRGBA", newScanNRGBA},
+		{"Gray", newScanGray},
+		{"YCbCr", newScanYCbCr},
+	} {
+		img := scan.image()
+		b.Run(fmt.Sprintf("%s-%dx%d", scan.name, scanWidth, scanHeight), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, found := findContentBounds(img, defaultBackgroundThreshold); !found {
+					b.Fatal("no content found")
+				}
+			}
+		})
+	}
+}
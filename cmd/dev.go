@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var devSchemaFile string
+
+var devCmd = &cobra.Command{
+	Use:   "dev",
+	Short: "Watch for changes and keep both the PDFs and the gig JSON Schema up to date",
+	Long: `Generate the PDFs and the gig JSON Schema, then watch the config, gig and image files
+and regenerate them whenever they change. This is equivalent to running generate --watch and
+generate-schema --watch together, but with a single watcher.`,
+	Run: runDev,
+}
+
+func init() {
+	addGenerateFlags(devCmd)
+	devCmd.Flags().StringVar(&devSchemaFile, "schema", "gig-schema.json", "Output JSON Schema file path")
+}
+
+func runDev(cmd *cobra.Command, args []string) {
+	readSpacingFlag(cmd)
+	runWatch(watchOptions{schemaFile: devSchemaFile})
+}
@@ -44,26 +44,11 @@ func runGenerateSchema(cmd *cobra.Command, args []string) {
 }
 
 func generateAndWriteSchema() error {
-	// Load configuration to extract song nicknames and image variants
-	config, err := loadConfig(schemaConfigFile)
-	if err != nil {
-		return fmt.Errorf("error loading config file: %w", err)
-	}
-
-	// Generate the JSON Schema
-	schema, err := generateJSONSchema(config)
+	err := writeGigSchema(schemaConfigFile, schemaOutputFile)
 	if err != nil {
-		return fmt.Errorf("error generating schema: %w", err)
+		return err
 	}
 
-	// Write schema to file
-	err = writeSchemaFile(schema, schemaOutputFile)
-	if err != nil {
-		return fmt.Errorf("error writing schema file: %w", err)
-	}
-
-	fmt.Printf("Successfully generated JSON Schema: %s\n", schemaOutputFile)
-
 	if !schemaWatch {
 		// Only show VS Code instructions once in non-watch mode
 		fmt.Println("To use in VS Code, add this to your settings.json:")
@@ -81,6 +66,30 @@ func generateAndWriteSchema() error {
 	return nil
 }
 
+// writeGigSchema generates the gig JSON Schema from the config file and writes it to outputFile
+func writeGigSchema(configPath string, outputFile string) error {
+	// Load configuration to extract song nicknames and image variants
+	config, err := loadConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("error loading config file: %w", err)
+	}
+
+	// Generate the JSON Schema
+	schema, err := generateJSONSchema(config)
+	if err != nil {
+		return fmt.Errorf("error generating schema: %w", err)
+	}
+
+	// Write schema to file
+	err = writeSchemaFile(schema, outputFile)
+	if err != nil {
+		return fmt.Errorf("error writing schema file: %w", err)
+	}
+
+	fmt.Printf("Successfully generated JSON Schema: %s\n", outputFile)
+	return nil
+}
+
 func watchConfigFile() {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
@@ -233,6 +242,15 @@ func generateJSONSchema(config *Config) (*JSONSchema, error) {
 				"type":        "string",
 				"description": "Name of the gig",
 			},
+			"date": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional gig date in YYYY-MM-DD format (available as {{.Date}} and {{.Year}} in outputPattern)",
+				"pattern":     "^[0-9]{4}-[0-9]{2}-[0-9]{2}$",
+			},
+			"venue": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional gig venue (available as {{.Venue}} in outputPattern)",
+			},
 			"sets": map[string]interface{}{
 				"type":        "array",
 				"description": "List of sets in the gig",
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"image"
 	"image/color"
@@ -10,11 +11,15 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/fsnotify/fsnotify"
+	"gigsheets/internal/pkg/imagecache"
+	"gigsheets/internal/pkg/status"
+
 	"github.com/jung-kurt/gofpdf"
 	"github.com/spf13/cobra"
 	"golang.org/x/image/draw"
@@ -23,24 +28,40 @@ import (
 
 // Config represents the structure of config.yaml
 type Config struct {
-	ImageFolder  string   `yaml:"imageFolder"`
-	GigsFolder   string   `yaml:"gigsFolder"`
-	OutputFolder string   `yaml:"outputFolder"`
-	Spacing      *float64 `yaml:"spacing,omitempty"` // Optional spacing between images
-	Songs        []Song   `yaml:"songs"`
+	ImageFolder   string                    `yaml:"imageFolder"`
+	GigsFolder    string                    `yaml:"gigsFolder"`
+	OutputFolder  string                    `yaml:"outputFolder"`
+	OutputPattern string                    `yaml:"outputPattern,omitempty"` // Optional template for gig PDF paths within outputFolder
+	CacheFolder   string                    `yaml:"cacheFolder,omitempty"`   // Optional cropped image cache folder (default: ~/.gigsheets/cache)
+	Spacing       *float64                  `yaml:"spacing,omitempty"`       // Optional spacing between images
+	Metadata      *MetadataConfig           `yaml:"metadata,omitempty"`      // Optional PDF document property overrides
+	Protection    *ProtectionConfig         `yaml:"protection,omitempty"`    // Optional PDF encryption and permissions
+	Watermark     *WatermarkConfig          `yaml:"watermark,omitempty"`     // Optional text drawn across every page
+	Image         *ImageConfig              `yaml:"image,omitempty"`         // Optional downsampling and recompression settings
+	Crop          *CropConfig               `yaml:"crop,omitempty"`          // Optional cropping settings for all images
+	Preprocess    *PreprocessConfig         `yaml:"preprocess,omitempty"`    // Optional clean-up of all images before cropping
+	Compact       *CompactConfig            `yaml:"compact,omitempty"`       // Optional collapsing of tall blank bands inside images
+	Theme         string                    `yaml:"theme,omitempty"`         // Optional: "dark" also generates a dark copy of each PDF (default: light)
+	LargePrint    *LargePrintConfig         `yaml:"largePrint,omitempty"`    // Optional large-print copy of each PDF
+	Profiles      map[string]*OutputProfile `yaml:"profiles,omitempty"`      // Optional tablet layouts, each generated as <gig>-<name>.pdf
+	Songs         []Song                    `yaml:"songs"`
 }
 
 // Song represents a song configuration
 type Song struct {
-	Nickname string            `yaml:"nickname"`
-	Image    string            `yaml:"image,omitempty"`  // For backward compatibility - single image
-	Images   map[string]string `yaml:"images,omitempty"` // For multiple named images
+	Nickname     string                   `yaml:"nickname"`
+	Image        string                   `yaml:"image,omitempty"`  // For backward compatibility - single image
+	Images       map[string]string        `yaml:"images,omitempty"` // For multiple named images
+	ImageOptions `yaml:",inline"`         // Optional image processing overrides for every image of the song
+	Variants     map[string]*ImageOptions `yaml:"variants,omitempty"` // Optional overrides for single images, keyed by image name ("default" for image)
 }
 
 // Gig represents the structure of gig.yaml
 type Gig struct {
-	Name string `yaml:"name"`
-	Sets []Set  `yaml:"sets"`
+	Name  string `yaml:"name"`
+	Date  string `yaml:"date,omitempty"`  // Optional gig date (YYYY-MM-DD), used in outputPattern
+	Venue string `yaml:"venue,omitempty"` // Optional venue, used in outputPattern
+	Sets  []Set  `yaml:"sets"`
 }
 
 // SetSongItem represents a single item in a set's songs list.
@@ -192,6 +213,15 @@ var (
 	outputOverride string   // Override output folder path
 	allSongs       bool     // Generate _all.pdf with all songs from config
 	debugMode      bool     // Enable debug logging
+	combineFile    string   // Tour file listing gigs to combine into one PDF
+	draftMode      bool     // Stamp pages with generation time and gig file revision
+	noCache        bool     // Disable the on-disk cropped image cache
+	jobsFlag       int      // Number of images or PDFs processed in parallel
+	maxSizeFlag    string   // Target maximum PDF size, e.g. "20MB"
+	forceRebuild   bool     // Regenerate PDFs even if their inputs have not changed
+	themeFlag      string   // Theme from --theme, overriding the config
+	largePrintFlag bool     // Also generate large-print PDFs
+	strictMode     bool     // Fail without writing PDFs if any song or colour in a gig does not resolve
 )
 
 var generateCmd = &cobra.Command{
@@ -203,191 +233,261 @@ in the gig file, using image paths from the configuration file.`,
 }
 
 func init() {
-	generateCmd.Flags().StringVarP(&configFile, "config", "c", "config.yaml", "Path to config YAML file")
 	generateCmd.Flags().BoolVarP(&watchMode, "watch", "w", false, "Watch for changes and regenerate automatically")
-	generateCmd.Flags().StringVarP(&imageOverride, "image-override", "i", "", "Image name to use for all songs if it exists, otherwise use the one specified in gig YAML")
-	generateCmd.Flags().StringVarP(&outputOverride, "output", "o", "", "Override output folder path from config file")
-	generateCmd.Flags().BoolVarP(&allSongs, "all-songs", "a", false, "Generate _all.pdf containing all songs from config (uses default image unless image-override is set)")
-	generateCmd.Flags().BoolVarP(&debugMode, "debug", "d", false, "Enable debug logging")
+	addGenerateFlags(generateCmd)
+}
 
-	// Use a local variable for the flag, then assign to spacingFlag in runGenerate
-	generateCmd.Flags().Float64P("spacing", "s", -1, "Spacing between images in mm (default: 5.0, or value from config)")
+// addGenerateFlags adds the flags that control PDF generation, shared by generate and dev
+func addGenerateFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&configFile, "config", "c", "config.yaml", "Path to config YAML file")
+	cmd.Flags().StringVarP(&imageOverride, "image-override", "i", "", "Image name to use for all songs if it exists, otherwise use the one specified in gig YAML")
+	cmd.Flags().StringVarP(&outputOverride, "output", "o", "", "Override output folder path from config file")
+	cmd.Flags().BoolVarP(&allSongs, "all-songs", "a", false, "Generate _all.pdf containing all songs from config (uses default image unless image-override is set)")
+	cmd.Flags().BoolVarP(&debugMode, "debug", "d", false, "Enable debug logging")
+	cmd.Flags().BoolVar(&draftMode, "draft", false, "Stamp every page with a DRAFT watermark, the generation time and the git revision of the gig file")
+	cmd.Flags().IntVarP(&jobsFlag, "jobs", "j", runtime.NumCPU(), "Number of images and PDFs to process in parallel")
+	cmd.Flags().StringVar(&maxSizeFlag, "max-size", "", "Maximum size of each PDF (e.g. 20MB); image quality is lowered until the PDF fits")
+	cmd.Flags().BoolVar(&noCache, "no-cache", false, "Disable the on-disk cache of cropped images")
+	cmd.Flags().BoolVar(&forceRebuild, "force", false, "Regenerate every PDF, even if its gig file, config and images have not changed")
+	cmd.Flags().StringVar(&themeFlag, "theme", "", "Theme: light, or dark to also generate <gig>-dark.pdf for dark stages (default: light, or value from config)")
+	cmd.Flags().BoolVar(&largePrintFlag, "large-print", false, "Also generate <gig>-large.pdf with full-width images and larger text")
+	cmd.Flags().BoolVar(&strictMode, "strict", false, "Fail without writing any PDFs if a song, image variant, image file or margin colour in a gig cannot be resolved")
+	cmd.Flags().StringVar(&combineFile, "combine", "", "Path to a tour YAML file listing gig files to combine into a single PDF")
+
+	// Use a local variable for the flag, then assign to spacingFlag in readSpacingFlag
+	cmd.Flags().Float64P("spacing", "s", -1, "Spacing between images in mm (default: 5.0, or value from config)")
 }
 
-func runGenerate(cmd *cobra.Command, args []string) {
-	// Get the spacing flag value
+// readSpacingFlag sets spacingFlag if --spacing was given
+func readSpacingFlag(cmd *cobra.Command) {
 	spacingValue, _ := cmd.Flags().GetFloat64("spacing")
 	if spacingValue >= 0 {
 		spacingFlag = &spacingValue
 	}
+}
+
+func runGenerate(cmd *cobra.Command, args []string) {
+	readSpacingFlag(cmd)
 
 	if watchMode {
-		runGenerateWatch()
+		runWatch(watchOptions{})
 	} else {
 		runGenerateOnce()
 	}
 }
 
 func runGenerateOnce() {
-	err := generateAllGigs()
+	err := generateOutputs()
+	var strictErr *strictError
+	if errors.As(err, &strictErr) {
+		log.Printf("Error generating PDFs: %v", err)
+		os.Exit(strictExitCode)
+	}
 	if err != nil {
 		log.Fatalf("Error generating PDFs: %v", err)
 	}
 }
 
-func runGenerateWatch() {
-	// Initial generation
-	fmt.Println("Initial PDF generation...")
-	err := generateAllGigs()
-	if err != nil {
-		log.Printf("Error during initial generation: %v", err)
+// resolveSpacing determines the spacing value to use based on priority:
+// 1. Command-line flag (if set)
+// 2. Config file value (if set)
+// 3. Default value (5.0)
+func resolveSpacing(config *Config) float64 {
+	// Priority 1: Command-line flag
+	if spacingFlag != nil {
+		return *spacingFlag
 	}
 
-	// Get the config directory for resolving relative paths
-	configDir := filepath.Dir(configFile)
+	// Priority 2: Config file
+	if config.Spacing != nil {
+		return *config.Spacing
+	}
 
-	// Load config to get gigs folder
-	config, err := loadConfig(configFile)
-	if err != nil {
-		log.Fatalf("Error loading config file: %v", err)
+	// Priority 3: Default
+	return 5.0
+}
+
+// resolveOutputDir returns the output folder, using outputOverride if set, otherwise the config value
+func resolveOutputDir(config *Config, configDir string) string {
+	if outputOverride != "" {
+		if filepath.IsAbs(outputOverride) {
+			return outputOverride
+		}
+		return filepath.Join(configDir, outputOverride)
 	}
+	return filepath.Join(configDir, config.OutputFolder)
+}
 
-	gigsDir := filepath.Join(configDir, config.GigsFolder)
+// renderOptions holds the settings shared by every PDF produced in one generation run
+type renderOptions struct {
+	imagesDir     string
+	spacing       float64
+	imageOverride string
+	protection    *pdfProtection
+	watermark     *pdfWatermark
+	draft         bool
+	generatedAt   time.Time
+	imageCache    *imagecache.Cache // nil when caching is disabled
+	images        *imageStore       // Images prepared so far in this run
+	imageSettings imageSettings
+	songSettings  map[string]map[string]imageSettings // Settings for songs with overrides, by nickname and image name
+	theme         pdfTheme                            // Theme of the PDF being rendered
+	largePrint    bool                                // Images fill the page width, even if that enlarges them
+	textScale     float64                             // Footer and message text size multiplier (1 = normal)
+	profile       *tabletProfile                      // Tablet page layout; nil for A4
+	sizeAttempt   int                                 // Attempt at fitting within maxSize; image quality is reduced after the first
+	jobs          int                                 // Maximum number of images or PDFs processed in parallel
+	maxSize       int64                               // Maximum PDF size in bytes (0 = no limit)
+}
 
-	// Set up file watcher
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		log.Fatalf("Error creating watcher: %v", err)
+// settingsFor returns the image settings for a song reference, including any per-song
+// and per-variant overrides, reduced for the current --max-size attempt
+func (o *renderOptions) settingsFor(songMap map[string]map[string]string, songRef string) imageSettings {
+	settings := o.imageSettings
+	nickname, imageName := songImageName(songMap, songRef, o.imageOverride)
+	if songSettings, exists := o.songSettings[nickname][imageName]; exists {
+		settings = songSettings
 	}
-	defer func() {
-		if err := watcher.Close(); err != nil {
-			log.Printf("Error closing watcher: %v", err)
+	settings.invert = o.theme.invertImages
+	return settings.reduced(o.sizeAttempt)
+}
+
+// canReduce reports whether the next attempt at fitting within --max-size lowers the quality or
+// resolution of any image settings, i.e. whether attempt has not yet reached the minimums
+func (o *renderOptions) canReduce(attempt int) bool {
+	if o.imageSettings.reducible(attempt) {
+		return true
+	}
+	for _, images := range o.songSettings {
+		for _, settings := range images {
+			if settings.reducible(attempt) {
+				return true
+			}
 		}
-	}()
+	}
+	return false
+}
 
-	// Watch config file
-	err = watcher.Add(configFile)
+// resolveRenderOptions resolves the config and command-line settings used when rendering PDFs,
+// so that invalid settings fail before any PDF is written
+func resolveRenderOptions(config *Config, configDir string) (*renderOptions, error) {
+	protection, err := resolveProtection(config, configDir)
 	if err != nil {
-		log.Fatalf("Error watching config file: %v", err)
+		return nil, err
 	}
 
-	// Watch gigs directory
-	err = watcher.Add(gigsDir)
+	watermark, err := resolveWatermark(config, draftMode)
 	if err != nil {
-		log.Fatalf("Error watching gigs directory: %v", err)
+		return nil, err
 	}
 
-	fmt.Printf("\nWatching for changes...\n")
-	fmt.Printf("  Config: %s\n", configFile)
-	fmt.Printf("  Gigs:   %s\n", gigsDir)
-	fmt.Println("\nPress Ctrl+C to stop")
-
-	// Debounce timer to avoid multiple regenerations for rapid file changes
-	var debounceTimer *time.Timer
-	debounceDuration := 500 * time.Millisecond
-
-	for {
-		select {
-		case event, ok := <-watcher.Events:
-			if !ok {
-				return
-			}
-
-			// Only process write and create events
-			if event.Op&fsnotify.Write == fsnotify.Write || event.Op&fsnotify.Create == fsnotify.Create {
-				// Cancel existing timer if any
-				if debounceTimer != nil {
-					debounceTimer.Stop()
-				}
+	// Images are never shown wider than the page width inside the margins
+	pageWidth, _ := newGigPDF().GetPageSize()
+	settings, err := resolveImageSettings(config, pageWidth-2*pageMargin)
+	if err != nil {
+		return nil, err
+	}
+	songSettings, err := resolveSongImageSettings(config, settings, false)
+	if err != nil {
+		return nil, err
+	}
 
-				// Set new timer
-				debounceTimer = time.AfterFunc(debounceDuration, func() {
-					fmt.Printf("\n[%s] Change detected in: %s\n", time.Now().Format("15:04:05"), filepath.Base(event.Name))
-					fmt.Println("Regenerating PDFs...")
+	maxSize, err := parseByteSize(maxSizeFlag)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --max-size: %w", err)
+	}
 
-					err := generateAllGigs()
-					if err != nil {
-						log.Printf("Error generating PDFs: %v", err)
-					} else {
-						fmt.Println("✓ PDFs regenerated successfully")
-					}
-				})
-			}
+	return &renderOptions{
+		imagesDir:     filepath.Join(configDir, config.ImageFolder),
+		spacing:       resolveSpacing(config),
+		imageOverride: imageOverride,
+		protection:    protection,
+		watermark:     watermark,
+		draft:         draftMode,
+		generatedAt:   time.Now(),
+		imageCache:    resolveImageCache(config, configDir),
+		images:        newImageStore(),
+		imageSettings: settings,
+		songSettings:  songSettings,
+		theme:         lightTheme,
+		textScale:     1,
+		jobs:          max(jobsFlag, 1),
+		maxSize:       maxSize,
+	}, nil
+}
 
-		case err, ok := <-watcher.Errors:
-			if !ok {
-				return
-			}
-			log.Printf("Watcher error: %v", err)
-		}
+// resolveImageCache returns the cropped image cache, or nil if disabled with --no-cache
+func resolveImageCache(config *Config, configDir string) *imagecache.Cache {
+	if noCache {
+		return nil
 	}
+	return imagecache.New(resolveCacheFolder(config, configDir))
 }
 
-// resolveSpacing determines the spacing value to use based on priority:
-// 1. Command-line flag (if set)
-// 2. Config file value (if set)
-// 3. Default value (5.0)
-func resolveSpacing(config *Config) float64 {
-	// Priority 1: Command-line flag
-	if spacingFlag != nil {
-		return *spacingFlag
+// resolveCacheFolder returns cacheFolder from the config if set, otherwise the default cache path
+func resolveCacheFolder(config *Config, configDir string) string {
+	if config.CacheFolder == "" {
+		return status.GetCachePath()
 	}
-
-	// Priority 2: Config file
-	if config.Spacing != nil {
-		return *config.Spacing
+	if filepath.IsAbs(config.CacheFolder) {
+		return config.CacheFolder
 	}
+	return filepath.Join(configDir, config.CacheFolder)
+}
 
-	// Priority 3: Default
-	return 5.0
+// generateOutputs runs the generation selected by the command-line flags
+func generateOutputs() error {
+	return generateSelectedOutputs(nil)
 }
 
-func generateAllGigs() error {
+// generateSelectedOutputs is like generateOutputs, but when gigFiles is not nil only the PDFs
+// for those gig files are generated (the config file selects _all.pdf). A combined tour PDF is
+// always generated in full.
+func generateSelectedOutputs(gigFiles map[string]bool) error {
+	if combineFile != "" {
+		return generateCombinedGigs()
+	}
+	// In strict mode fixing one gig may unblock every PDF, so all of them are considered; the
+	// build manifest still skips those that are up to date
+	if strictMode {
+		gigFiles = nil
+	}
+	return generateAllGigs(gigFiles)
+}
+
+// generateAllGigs generates a PDF for every gig file in the gigs folder, plus _all.pdf with
+// --all-songs. When only is not nil, just the PDFs for the (absolute) gig file paths in it are
+// generated; every gig is still loaded so that output name clashes are reported consistently.
+func generateAllGigs(only map[string]bool) error {
 	// Load configuration
 	config, err := loadConfig(configFile)
 	if err != nil {
 		return fmt.Errorf("error loading config file: %w", err)
 	}
 
-	// Resolve the spacing value
-	spacing := resolveSpacing(config)
-
 	// Get the config directory for resolving relative paths
 	configDir := filepath.Dir(configFile)
 
 	// Resolve paths relative to config file
 	gigsDir := filepath.Join(configDir, config.GigsFolder)
+	outputDir := resolveOutputDir(config, configDir)
 
-	// Use outputOverride if set, otherwise use config value
-	var outputDir string
-	if outputOverride != "" {
-		if filepath.IsAbs(outputOverride) {
-			outputDir = outputOverride
-		} else {
-			outputDir = filepath.Join(configDir, outputOverride)
-		}
-	} else {
-		outputDir = filepath.Join(configDir, config.OutputFolder)
+	// Resolve spacing, protection, watermark etc. once for all PDFs
+	opts, err := resolveRenderOptions(config, configDir)
+	if err != nil {
+		return err
 	}
 
-	imagesDir := filepath.Join(configDir, config.ImageFolder)
-
 	// Create output directory if it doesn't exist
 	err = os.MkdirAll(outputDir, 0755)
 	if err != nil {
 		return fmt.Errorf("error creating output directory: %w", err)
 	}
 
-	// Read all gig files from the gigs directory (both .yaml and .yml)
-	yamlFiles, err := filepath.Glob(filepath.Join(gigsDir, "*.yaml"))
-	if err != nil {
-		return fmt.Errorf("error reading gig files: %w", err)
-	}
-	ymlFiles, err := filepath.Glob(filepath.Join(gigsDir, "*.yml"))
+	gigFiles, err := findGigFiles(gigsDir)
 	if err != nil {
-		return fmt.Errorf("error reading gig files: %w", err)
+		return err
 	}
-	gigFiles := append(yamlFiles, ymlFiles...)
 
 	if len(gigFiles) == 0 {
 		log.Printf("No gig files found in %s", gigsDir)
@@ -396,7 +496,37 @@ func generateAllGigs() error {
 
 	fmt.Printf("Found %d gig file(s) in %s\n", len(gigFiles), gigsDir)
 
-	// Process each gig file
+	// With --strict, check every gig before anything is generated
+	err = checkStrict(config, opts, gigFiles, allSongs)
+	if err != nil {
+		return err
+	}
+
+	outputPattern, err := parseOutputPattern(config)
+	if err != nil {
+		return err
+	}
+
+	variants, err := resolveOutputVariants(config, opts)
+	if err != nil {
+		return err
+	}
+
+	songMap := buildSongMap(config)
+
+	// pdfJob is one PDF to render: a gig file, or the in-memory all-songs gig, in one output variant
+	type pdfJob struct {
+		gig        *Gig
+		gigFile    string
+		outputFile string
+		variant    string // The output variant's name, e.g. "dark theme"; empty for the normal PDF
+		opts       *renderOptions
+		inputs     manifestEntry
+		generated  bool
+	}
+	var pdfJobs []*pdfJob
+
+	// Load each gig file and resolve its output path
 	for _, gigFile := range gigFiles {
 		// Load gig
 		gig, err := loadGig(gigFile)
@@ -405,22 +535,24 @@ func generateAllGigs() error {
 			continue
 		}
 
-		// Generate output filename
-		gigBasename := filepath.Base(gigFile)
-		gigName := strings.TrimSuffix(gigBasename, filepath.Ext(gigBasename))
-		outputFile := filepath.Join(outputDir, gigName+".pdf")
+		// Generate output filename from the configured pattern
+		outputFile, err := resolveOutputPath(outputPattern, outputDir, newOutputNameData(gig, gigFile, imageOverride))
+		if err != nil {
+			log.Printf("Error resolving output path for %s: %v", gigFile, err)
+			continue
+		}
 
-		// Generate PDF
-		err = generatePDF(config, gig, outputFile, imagesDir, gigFile, spacing, imageOverride)
+		// Create sub-directories produced by the pattern
+		err = os.MkdirAll(filepath.Dir(outputFile), 0755)
 		if err != nil {
-			log.Printf("Error generating PDF for %s: %v", gigFile, err)
+			log.Printf("Error creating output directory for %s: %v", gigFile, err)
 			continue
 		}
 
-		fmt.Printf("Successfully generated PDF: %s\n", outputFile)
+		pdfJobs = append(pdfJobs, &pdfJob{gig: gig, gigFile: gigFile, outputFile: outputFile})
 	}
 
-	// Generate _all.pdf if --all-songs flag is set
+	// Add _all.pdf if --all-songs flag is set
 	if allSongs {
 		// Build filename based on image override
 		allSongsFilename := "_all.pdf"
@@ -429,33 +561,148 @@ func generateAllGigs() error {
 		}
 		allSongsFile := filepath.Join(outputDir, allSongsFilename)
 
-		// Create an in-memory gig with all songs from config
-		allSongsGig := &Gig{
-			Name: "All Songs",
-			Sets: []Set{
-				{
-					Name:  "All Songs",
-					Songs: make([]SetSongItem, len(config.Songs)),
-				},
-			},
+		pdfJobs = append(pdfJobs, &pdfJob{gig: newAllSongsGig(config), gigFile: configFile, outputFile: allSongsFile})
+	}
+
+	// Each gig is rendered once per output variant, e.g. gig.pdf, gig-dark.pdf and gig-large.pdf
+	var variantJobs []*pdfJob
+	for _, job := range pdfJobs {
+		for _, variant := range variants {
+			variantJobs = append(variantJobs, &pdfJob{
+				gig:        job.gig,
+				gigFile:    job.gigFile,
+				outputFile: variant.outputPath(job.outputFile),
+				variant:    variant.name,
+				opts:       variant.opts,
+			})
 		}
+	}
+	pdfJobs = variantJobs
 
-		// Populate the songs list (use default image unless image-override is set)
-		for i, song := range config.Songs {
-			allSongsGig.Sets[0].Songs[i] = SetSongItem{Song: song.Nickname}
+	// Report outputs that map to the same file, e.g. two gigs the pattern gives the same name or a
+	// profile named like a combination of other variants, rather than one overwriting the other
+	describe := func(job *pdfJob) string {
+		if job.variant == "" {
+			return job.gigFile
 		}
+		return fmt.Sprintf("%s (%s)", job.gigFile, job.variant)
+	}
+	generatedFrom := make(map[string]*pdfJob)
+	for _, job := range pdfJobs {
+		if previous, exists := generatedFrom[job.outputFile]; exists {
+			log.Printf("Warning: %s and %s both map to %s; only %s is generated", describe(previous), describe(job), job.outputFile, describe(job))
+		}
+		generatedFrom[job.outputFile] = job
+	}
 
-		err = generatePDF(config, allSongsGig, allSongsFile, imagesDir, "config", spacing, imageOverride)
-		if err != nil {
-			log.Printf("Error generating _all.pdf: %v", err)
+	// Jobs that are not generated are removed from pdfJobs, so the loops below see only jobs to run
+	pdfJobs = slices.DeleteFunc(pdfJobs, func(job *pdfJob) bool {
+		return generatedFrom[job.outputFile] != job || (only != nil && !only[absolutePath(job.gigFile)])
+	})
+
+	// Skip PDFs generated from the same inputs last time. Drafts are always regenerated
+	// as they are stamped with the generation time.
+	manifest := loadBuildManifest(outputDir)
+	total := len(pdfJobs)
+	pdfJobs = slices.DeleteFunc(pdfJobs, func(job *pdfJob) bool {
+		job.inputs = manifest.entryFor(config, job.gig, job.gigFile, songMap, job.opts)
+		if !forceRebuild && !opts.draft && manifest.upToDate(job.outputFile, job.inputs) {
+			if debugMode {
+				log.Printf("[DEBUG] %s is up to date", job.outputFile)
+			}
+			return true
+		}
+		return false
+	})
+	if skipped := total - len(pdfJobs); skipped > 0 {
+		fmt.Printf("Skipped %d up-to-date PDF(s) (use --force to regenerate)\n", skipped)
+	}
+
+	// Crop and encode every image used by any PDF in parallel, each image only once
+	var requests []imageRequest
+	for _, job := range pdfJobs {
+		requests = append(requests, gigImageRequests(songMap, job.gig, job.opts)...)
+	}
+	opts.images.prepareAll(requests, opts.jobs, opts.imageCache)
+
+	// Render the PDFs in parallel, writing output in gig file order
+	var tasks []func(out *jobOutput)
+	for _, job := range pdfJobs {
+		tasks = append(tasks, func(out *jobOutput) {
+			err := generatePDF(config, job.gig, job.outputFile, job.gigFile, job.opts, out)
+			if err != nil {
+				out.Logf("Error generating PDF for %s: %v", job.gigFile, err)
+				return
+			}
+			job.generated = true
+			out.Printf("Successfully generated PDF: %s\n", job.outputFile)
+		})
+	}
+	runOrdered(opts.jobs, tasks)
+
+	failed := 0
+	for _, job := range pdfJobs {
+		if job.generated {
+			manifest.record(job.outputFile, job.inputs)
 		} else {
-			fmt.Printf("Successfully generated PDF: %s\n", allSongsFile)
+			manifest.forget(job.outputFile)
+			failed++
 		}
 	}
+	err = manifest.save()
+	if err != nil {
+		log.Printf("Warning: %v", err)
+	}
 
+	if failed > 0 {
+		return fmt.Errorf("%d PDF(s) could not be generated", failed)
+	}
 	return nil
 }
 
+// newAllSongsGig creates an in-memory gig with all songs from config, used for _all.pdf
+func newAllSongsGig(config *Config) *Gig {
+	allSongsGig := &Gig{
+		Name: "All Songs",
+		Sets: []Set{
+			{
+				Name:  "All Songs",
+				Songs: make([]SetSongItem, len(config.Songs)),
+			},
+		},
+	}
+
+	// Populate the songs list (use default image unless image-override is set)
+	for i, song := range config.Songs {
+		allSongsGig.Sets[0].Songs[i] = SetSongItem{Song: song.Nickname}
+	}
+
+	return allSongsGig
+}
+
+// absolutePath returns the absolute form of path, or path itself if that fails,
+// so that paths from different sources (globs, fsnotify events, tour files) can be compared
+func absolutePath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	return abs
+}
+
+// findGigFiles lists the gig files in gigsDir (both .yaml and .yml)
+func findGigFiles(gigsDir string) ([]string, error) {
+	yamlFiles, err := filepath.Glob(filepath.Join(gigsDir, "*.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("error reading gig files: %w", err)
+	}
+	ymlFiles, err := filepath.Glob(filepath.Join(gigsDir, "*.yml"))
+	if err != nil {
+		return nil, fmt.Errorf("error reading gig files: %w", err)
+	}
+	return append(yamlFiles, ymlFiles...), nil
+}
+
 func loadConfig(filename string) (*Config, error) {
 	data, err := os.ReadFile(filename)
 	if err != nil {
@@ -486,8 +733,9 @@ func loadGig(filename string) (*Gig, error) {
 	return &gig, nil
 }
 
-// isWhiteOrTransparent checks if a pixel is white or transparent
-func isWhiteOrTransparent(c color.Color) bool {
+// isWhiteOrTransparent checks if a pixel is white or transparent. Every colour channel must be
+// at least threshold for the pixel to count as white.
+func isWhiteOrTransparent(c color.Color, threshold uint8) bool {
 	r, g, b, a := c.RGBA()
 
 	// Check if transparent (alpha = 0)
@@ -501,167 +749,95 @@ func isWhiteOrTransparent(c color.Color) bool {
 	b8 := uint8(b >> 8)
 
 	// Check if white (or very close to white)
-	threshold := uint8(240) // Allow slight variations from pure white
 	return r8 >= threshold && g8 >= threshold && b8 >= threshold
 }
 
-// findLeftMostContent finds the leftmost non-white, non-transparent column
-func findLeftMostContent(img image.Image) int {
-	bounds := img.Bounds()
-
-	// Scan from left to right
-	for x := bounds.Min.X; x < bounds.Max.X; x++ {
-		// Check column from top to bottom
-		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-			if !isWhiteOrTransparent(img.At(x, y)) {
-				return x
-			}
-		}
-	}
-
-	// If no content found, return original left boundary
-	return bounds.Min.X
-}
-
-// findTopMostContent finds the topmost non-white, non-transparent row
-func findTopMostContent(img image.Image) int {
-	bounds := img.Bounds()
-
-	// Scan from top to bottom
-	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-		// Check row from left to right
-		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			if !isWhiteOrTransparent(img.At(x, y)) {
-				return y
-			}
-		}
-	}
-
-	// If no content found, return original top boundary
-	return bounds.Min.Y
-}
-
-// findBottomMostContent finds the bottommost non-white, non-transparent row
-func findBottomMostContent(img image.Image) int {
-	bounds := img.Bounds()
-
-	// Scan from bottom to top
-	for y := bounds.Max.Y - 1; y >= bounds.Min.Y; y-- {
-		// Check row from left to right
-		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			if !isWhiteOrTransparent(img.At(x, y)) {
-				return y + 1 // Return the position after the last content row
-			}
-		}
-	}
-
-	// If no content found, return original bottom boundary
-	return bounds.Max.Y
-}
-
-// findRightMostContent finds the rightmost non-white, non-transparent column
-func findRightMostContent(img image.Image) int {
-	bounds := img.Bounds()
-
-	// Scan from right to left
-	for x := bounds.Max.X - 1; x >= bounds.Min.X; x-- {
-		// Check column from top to bottom
-		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-			if !isWhiteOrTransparent(img.At(x, y)) {
-				return x + 1 // Return the position after the last content column
-			}
-		}
-	}
-
-	// If no content found, return original right boundary
-	return bounds.Max.X
-}
-
-// cropImage crops the image from all edges (top, left, bottom, right) up to the content boundaries
-func cropImage(imagePath string, songName string) (image.Image, error) {
-	// Open the image file
-	file, err := os.Open(imagePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open image: %w", err)
-	}
-	defer func() {
-		if err := file.Close(); err != nil {
-			// Log the error but don't fail the operation since we're in defer
-			log.Printf("Warning: failed to close file %s: %v", imagePath, err)
-		}
-	}()
-
-	// Decode the image based on file extension
+// decodeImage decodes image data based on the file extension of its source
+func decodeImage(data []byte, ext string) (image.Image, error) {
 	var img image.Image
-	ext := strings.ToLower(filepath.Ext(imagePath))
+	var err error
+	reader := bytes.NewReader(data)
 	switch ext {
 	case ".png":
-		img, err = png.Decode(file)
+		img, err = png.Decode(reader)
 	case ".jpg", ".jpeg":
-		img, err = jpeg.Decode(file)
+		img, err = jpeg.Decode(reader)
 	default:
 		// Try to decode as generic image
-		img, _, err = image.Decode(file)
+		img, _, err = image.Decode(reader)
 	}
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode image: %w", err)
 	}
+	return img, nil
+}
 
-	// Find the content boundaries
+// cropImage crops the image from all edges (top, left, bottom, right) up to the content boundaries,
+// or to the manual crop box if one is set, and adds any padding as white space around the result.
+// It returns the cropped image and the area of the original image it covers (which extends
+// beyond the original image where padding was added).
+func cropImage(img image.Image, songName string, crop cropSettings, out *jobOutput) (image.Image, image.Rectangle) {
 	bounds := img.Bounds()
-	leftMostX := findLeftMostContent(img)
-	topMostY := findTopMostContent(img)
-	bottomMostY := findBottomMostContent(img)
-	rightMostX := findRightMostContent(img)
-
-	// If no cropping needed, return original image
-	if leftMostX <= bounds.Min.X && topMostY <= bounds.Min.Y && bottomMostY >= bounds.Max.Y && rightMostX >= bounds.Max.X {
+	if !crop.enabled {
 		if debugMode {
-			log.Printf("[DEBUG] Image '%s' - no cropping needed: %dx%d", songName, bounds.Dx(), bounds.Dy())
+			out.Logf("[DEBUG] Image '%s' - cropping disabled: %dx%d", songName, bounds.Dx(), bounds.Dy())
 		}
-		return img, nil
+		return img, bounds
 	}
 
-	// Calculate the cropped dimensions
-	croppedWidth := rightMostX - leftMostX
-	croppedHeight := bottomMostY - topMostY
+	// Find the content boundaries (the whole image if it has no content)
+	var contentBounds image.Rectangle
+	source := "content"
+	if !crop.box.Empty() {
+		contentBounds = crop.box.Add(bounds.Min).Intersect(bounds)
+		source = "manual box"
+		if contentBounds.Empty() {
+			out.Logf("Warning: crop box %v for '%s' is outside the %dx%d image; using the whole image", crop.box, songName, bounds.Dx(), bounds.Dy())
+			contentBounds = bounds
+		}
+	} else if crop.mode == cropModeTolerant {
+		contentBounds, _ = findContentBoundsTolerant(img, crop.threshold, crop.noiseSize)
+		source = "content (tolerant)"
+	} else {
+		contentBounds, _ = findContentBounds(img, crop.threshold)
+	}
 
-	// Validate dimensions
-	if croppedWidth <= 0 || croppedHeight <= 0 {
-		// If dimensions are invalid, return original image
+	// Padding may extend beyond the original image; the extra area is filled with white
+	cropBounds := contentBounds.Inset(-crop.paddingPx)
+
+	// If no cropping needed, return original image
+	if cropBounds == bounds {
 		if debugMode {
-			log.Printf("[DEBUG] Image '%s' - invalid crop dimensions, using original", songName)
+			out.Logf("[DEBUG] Image '%s' - no cropping needed: %dx%d", songName, bounds.Dx(), bounds.Dy())
 		}
-		return img, nil
+		return img, bounds
 	}
 
 	if debugMode {
-		originalWidth := bounds.Dx()
-		originalHeight := bounds.Dy()
-		croppedLeft := leftMostX - bounds.Min.X
-		croppedTop := topMostY - bounds.Min.Y
-		croppedRight := bounds.Max.X - rightMostX
-		croppedBottom := bounds.Max.Y - bottomMostY
-		log.Printf("[DEBUG] Image '%s' - cropping: original=%dx%d, cropped=%dx%d, removed: left=%d, top=%d, right=%d, bottom=%d",
-			songName, originalWidth, originalHeight, croppedWidth, croppedHeight,
-			croppedLeft, croppedTop, croppedRight, croppedBottom)
+		out.Logf("[DEBUG] Image '%s' - cropping to %s %v (threshold=%d, padding=%dpx): original=%dx%d, cropped=%dx%d, removed: left=%d, top=%d, right=%d, bottom=%d",
+			songName, source, contentBounds.Sub(bounds.Min), crop.threshold, crop.paddingPx,
+			bounds.Dx(), bounds.Dy(), cropBounds.Dx(), cropBounds.Dy(),
+			cropBounds.Min.X-bounds.Min.X, cropBounds.Min.Y-bounds.Min.Y, bounds.Max.X-cropBounds.Max.X, bounds.Max.Y-cropBounds.Max.Y)
 	}
 
 	// Create cropped image with new dimensions
-	croppedBounds := image.Rect(0, 0, croppedWidth, croppedHeight)
-	croppedImg := image.NewRGBA(croppedBounds)
+	croppedImg := image.NewRGBA(image.Rect(0, 0, cropBounds.Dx(), cropBounds.Dy()))
+	if crop.paddingPx > 0 {
+		draw.Draw(croppedImg, croppedImg.Bounds(), image.White, image.Point{}, draw.Src)
+	}
 
 	// Copy the cropped portion
-	srcRect := image.Rect(leftMostX, topMostY, rightMostX, bottomMostY)
-	draw.Copy(croppedImg, croppedImg.Bounds().Min, img, srcRect, draw.Src, nil)
+	srcRect := cropBounds.Intersect(bounds)
+	draw.Copy(croppedImg, srcRect.Min.Sub(cropBounds.Min), img, srcRect, draw.Src, nil)
 
-	return croppedImg, nil
+	return croppedImg, cropBounds
 }
 
-// addErrorText adds red error text to the PDF at the current position
-func addErrorText(pdf *gofpdf.Fpdf, currentY *float64, pageWidth, pageHeight, margin, footerHeight, spacing float64, errorMsg string, addFooter func(string), setName string) {
-	errorHeight := 10.0 // Height for error message
+// addErrorText adds red error text to the PDF at the current position. The font size is
+// multiplied by textScale.
+func addErrorText(pdf *gofpdf.Fpdf, currentY *float64, pageWidth, pageHeight, margin, footerHeight, spacing, textScale float64, errorMsg string, addFooter func(string), setName string) {
+	errorHeight := 10.0 * textScale // Height for error message
 
 	// Calculate available space on current page
 	remainingHeight := pageHeight - footerHeight - margin - *currentY
@@ -675,7 +851,7 @@ func addErrorText(pdf *gofpdf.Fpdf, currentY *float64, pageWidth, pageHeight, ma
 
 	// Set red text color (RGB: 255, 0, 0)
 	pdf.SetTextColor(255, 0, 0)
-	pdf.SetFont("Arial", "B", 12)
+	pdf.SetFont("Arial", "B", 12*textScale)
 
 	// Add the error message
 	pdf.SetXY(margin, *currentY)
@@ -718,8 +894,9 @@ func parseHexColor(value string) (*rgbColor, error) {
 	}, nil
 }
 
-func generatePDF(config *Config, gig *Gig, outputPath string, imagesDir string, gigFile string, spacing float64, imageOverride string) error {
-	// Create a map for quick song lookup that supports both single and multiple images
+// buildSongMap creates a map for quick song lookup that supports both single and multiple images:
+// songMap[nickname][imageName] = image path
+func buildSongMap(config *Config) map[string]map[string]string {
 	songMap := make(map[string]map[string]string)
 	for _, song := range config.Songs {
 		imageMap := make(map[string]string)
@@ -738,17 +915,180 @@ func generatePDF(config *Config, gig *Gig, outputPath string, imagesDir string,
 
 		songMap[song.Nickname] = imageMap
 	}
+	return songMap
+}
 
-	// No need for temp files cleanup anymore since we're working in-memory
+// songImageError describes why a song reference could not be resolved to an image.
+// The message is shown in the PDF, so it reads as a sentence.
+type songImageError struct {
+	message string
+}
+
+func (e *songImageError) Error() string {
+	return e.message
+}
+
+// resolveSongImage resolves a gig song reference ("song" or "song#variant") to the path of
+// an existing image file, applying the image override if the song has that variant
+func resolveSongImage(songMap map[string]map[string]string, songName string, imageOverride string, imagesDir string) (string, error) {
+	actualSongName, imageName := songImageName(songMap, songName, imageOverride)
+
+	// Look up the song in the map
+	imageMap, exists := songMap[actualSongName]
+	if !exists {
+		return "", &songImageError{fmt.Sprintf("No configuration found for song '%s'", actualSongName)}
+	}
+
+	// Look up the specific image
+	imagePath, exists := imageMap[imageName]
+	if !exists {
+		return "", &songImageError{fmt.Sprintf("No image '%s' found for song '%s'", imageName, actualSongName)}
+	}
+
+	// Make image path relative to images directory if it's not absolute
+	if !filepath.IsAbs(imagePath) {
+		imagePath = filepath.Join(imagesDir, imagePath)
+	}
+
+	// Check if image file exists
+	if _, err := os.Stat(imagePath); os.IsNotExist(err) {
+		return "", &songImageError{fmt.Sprintf("Image file not found: %s", imagePath)}
+	}
 
-	// Create PDF
+	return imagePath, nil
+}
+
+// songImageName splits a song reference into the song nickname and the name of the image to
+// use, applying the image override if the song has an image of that name
+func songImageName(songMap map[string]map[string]string, songRef string, imageOverride string) (string, string) {
+	// Parse song name and image name
+	parts := strings.SplitN(songRef, "#", 2)
+	nickname := parts[0]
+	imageName := "default"
+	if len(parts) > 1 {
+		imageName = parts[1]
+	}
+
+	// Apply image override if specified
+	if imageOverride != "" {
+		// Check if the override image exists for this song
+		if _, exists := songMap[nickname][imageOverride]; exists {
+			imageName = imageOverride
+		}
+		// Otherwise, keep the imageName from the gig YAML
+	}
+
+	return nickname, imageName
+}
+
+// gigSongRefs returns every song reference in a gig, in running order
+func gigSongRefs(gig *Gig) []string {
+	var refs []string
+	for _, set := range gig.Sets {
+		for _, item := range set.Songs {
+			if item.Group != nil {
+				refs = append(refs, item.Group.Songs...)
+			} else if strings.TrimSpace(item.Song) != "" {
+				refs = append(refs, item.Song)
+			}
+		}
+	}
+	return refs
+}
+
+// pageMargin is the margin around the content of every page, in mm
+const pageMargin = 10.0
+
+// newGigPDF creates an empty A4 document with the page settings used for all gig PDFs
+func newGigPDF() *gofpdf.Fpdf {
 	pdf := gofpdf.New("P", "mm", "A4", "")
 	pdf.SetAutoPageBreak(false, 0)
+	return pdf
+}
+
+func generatePDF(config *Config, gig *Gig, outputPath string, gigFile string, opts *renderOptions, out *jobOutput) error {
+	return writePDF(outputPath, opts, out, func(opts *renderOptions, out *jobOutput) *gofpdf.Fpdf {
+		pdf := opts.newPDF()
+		applyPDFProtection(pdf, opts.protection)
+		applyTheme(pdf, opts.theme)
+		applyWatermark(pdf, opts.watermark)
+		renderGig(pdf, config, gig, gigFile, opts, false, out)
+		applyPDFMetadata(pdf, gigMetadata(config, gig))
+		return pdf
+	})
+}
+
+// writePDF renders a PDF and saves it to outputPath. If --max-size is set and the PDF is
+// too large, it is rendered again with progressively lower image quality until it fits.
+// Warnings are only reported for the first rendering, as later ones repeat them.
+func writePDF(outputPath string, opts *renderOptions, out *jobOutput, render func(opts *renderOptions, out *jobOutput) *gofpdf.Fpdf) error {
+	var data bytes.Buffer
+	for attempt := 0; ; attempt++ {
+		attemptOpts := opts
+		attemptOut := out
+		if attempt > 0 {
+			reducedOpts := *opts
+			reducedOpts.sizeAttempt = attempt
+			attemptOpts = &reducedOpts
+			attemptOut = &jobOutput{buffered: true} // Discarded
+		}
+
+		data.Reset()
+		err := render(attemptOpts, attemptOut).Output(&data)
+		if err != nil {
+			return fmt.Errorf("failed to save PDF: %w", err)
+		}
+
+		if opts.maxSize <= 0 || int64(data.Len()) <= opts.maxSize {
+			break
+		}
+
+		// Image dictionaries are not compressed, so the images' types can be seen in the output
+		hasImages := bytes.Contains(data.Bytes(), []byte("/Subtype /Image"))
+		hasJPEG := bytes.Contains(data.Bytes(), []byte("/Filter /DCTDecode"))
+		if !hasImages {
+			out.Logf("Warning: %s is %s, larger than --max-size %s, and has no images to reduce", outputPath, formatBytes(int64(data.Len())), formatBytes(opts.maxSize))
+			break
+		}
+		if !opts.canReduce(attempt) {
+			lowest := "the lowest resolution (72 DPI)"
+			if hasJPEG {
+				lowest = "the lowest image quality (JPEG quality 30 at 72 DPI)"
+			}
+			out.Logf("Warning: %s is %s, larger than --max-size %s even at %s", outputPath, formatBytes(int64(data.Len())), formatBytes(opts.maxSize), lowest)
+			break
+		}
+
+		// JPEG quality has no effect on PNG images, so it is only mentioned if there are JPEGs
+		next := opts.imageSettings.reduced(attempt + 1)
+		if hasJPEG {
+			out.Printf("%s is %s, over --max-size; retrying with JPEG quality %d at %g DPI\n", filepath.Base(outputPath), formatBytes(int64(data.Len())), next.jpegQuality, next.maxDpi)
+		} else {
+			out.Printf("%s is %s, over --max-size; retrying at %g DPI\n", filepath.Base(outputPath), formatBytes(int64(data.Len())), next.maxDpi)
+		}
+	}
+
+	err := os.WriteFile(outputPath, data.Bytes(), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to save PDF: %w", err)
+	}
+
+	return nil
+}
+
+// renderGig lays out all sets of a gig into pdf, starting on a new page.
+// Page numbers in the footer start from 1 for each gig. When bookmarks is true,
+// an outline entry is added for the gig and one for each of its sets.
+func renderGig(pdf *gofpdf.Fpdf, config *Config, gig *Gig, gigFile string, opts *renderOptions, bookmarks bool, out *jobOutput) {
+	spacing := opts.spacing
+	songMap := buildSongMap(config)
+
+	// No need for temp files cleanup anymore since we're working in-memory
 
 	// Page dimensions and layout constants
 	pageWidth, pageHeight := pdf.GetPageSize()
-	margin := 10.0
-	footerHeight := 15.0
+	margin := pageMargin
+	footerHeight := 10.0 + 5.0*opts.textScale // 15mm at the normal text size
 	marginBandWidth := 1.0
 	marginBandRightGap := 1.0
 	availableWidth := pageWidth - 2*margin
@@ -757,15 +1097,34 @@ func generatePDF(config *Config, gig *Gig, outputPath string, imagesDir string,
 	currentY := margin
 	pageNum := 0
 
+	draftStamp := ""
+	if opts.draft {
+		draftStamp = draftStampText(gigFile, opts.generatedAt)
+	}
+
 	// Add footer function
 	addFooter := func(setName string) {
 		pageNum++
 		pdf.SetY(pageHeight - footerHeight)
-		pdf.SetFont("Arial", "", 8)
-		pdf.Cell(0, 5, fmt.Sprintf("%s - Page %d - %s", gig.Name, pageNum, setName))
+		pdf.SetFont("Arial", "", 8*opts.textScale)
+		pdf.SetTextColor(opts.theme.text.r, opts.theme.text.g, opts.theme.text.b)
+		pdf.Cell(0, 5*opts.textScale, fmt.Sprintf("%s - Page %d - %s", gig.Name, pageNum, setName))
+
+		// Draft stamp sits in the top margin, clear of the song images
+		if draftStamp != "" {
+			pdf.SetTextColor(255, 0, 0)
+			pdf.SetXY(margin, margin/2-2.5)
+			pdf.CellFormat(0, 5, draftStamp, "", 0, "R", false, 0, "")
+			pdf.SetTextColor(0, 0, 0)
+		}
 	}
 
 	addGroupSeparator := func(setName string) {
+		// Tablet layouts put every song on its own page, so groups need no separator
+		if opts.profile != nil {
+			return
+		}
+
 		separatorPadding := 1.2
 		requiredHeight := separatorPadding * 2
 		remainingHeight := pageHeight - footerHeight - margin - currentY
@@ -777,134 +1136,108 @@ func generatePDF(config *Config, gig *Gig, outputPath string, imagesDir string,
 		}
 
 		lineY := currentY + separatorPadding
+		pdf.SetDrawColor(opts.theme.line.r, opts.theme.line.g, opts.theme.line.b)
 		pdf.Line(margin, lineY, pageWidth-margin, lineY)
 		currentY += requiredHeight
 	}
 
 	renderSong := func(songName string, setName string, marginBandColor *rgbColor) bool {
-		// Parse song name and image name
-		parts := strings.SplitN(songName, "#", 2)
-		actualSongName := parts[0]
-		imageName := "default"
-		if len(parts) > 1 {
-			imageName = parts[1]
-		}
-
-		// Look up the song in the map
-		imageMap, exists := songMap[actualSongName]
-		if !exists {
-			errorMsg := fmt.Sprintf("ERROR: No configuration found for song '%s'", actualSongName)
-			log.Printf("%s: Warning: %s", gigFile, errorMsg)
-			addErrorText(pdf, &currentY, pageWidth, pageHeight, margin, footerHeight, spacing, errorMsg, addFooter, setName)
-			return true
-		}
-
-		// Apply image override if specified
-		if imageOverride != "" {
-			// Check if the override image exists for this song
-			if _, exists := imageMap[imageOverride]; exists {
-				imageName = imageOverride
-			}
-			// Otherwise, keep the imageName from the gig YAML
-		}
-
-		// Look up the specific image
-		imagePath, exists := imageMap[imageName]
-		if !exists {
-			errorMsg := fmt.Sprintf("ERROR: No image '%s' found for song '%s'", imageName, actualSongName)
-			log.Printf("%s: Warning: %s", gigFile, errorMsg)
-			addErrorText(pdf, &currentY, pageWidth, pageHeight, margin, footerHeight, spacing, errorMsg, addFooter, setName)
-			return true
-		}
-
-		// Make image path relative to images directory if it's not absolute
-		if !filepath.IsAbs(imagePath) {
-			imagePath = filepath.Join(imagesDir, imagePath)
-		}
-
-		// Check if image file exists
-		if _, err := os.Stat(imagePath); os.IsNotExist(err) {
-			errorMsg := fmt.Sprintf("ERROR: Image file not found: %s", imagePath)
-			log.Printf("%s: Warning: %s", gigFile, errorMsg)
-			addErrorText(pdf, &currentY, pageWidth, pageHeight, margin, footerHeight, spacing, errorMsg, addFooter, setName)
-			return true
-		}
-
-		// Crop the image to remove white/transparent space from top, left, and bottom
-		croppedImg, err := cropImage(imagePath, songName)
+		imagePath, err := resolveSongImage(songMap, songName, opts.imageOverride, opts.imagesDir)
 		if err != nil {
-			log.Printf("%s: Warning: Could not crop image %s: %v", gigFile, imagePath, err)
-			croppedImg = nil // Will use original file path below
+			errorMsg := fmt.Sprintf("ERROR: %v", err)
+			out.Logf("%s: Warning: %s", gigFile, errorMsg)
+			addErrorText(pdf, &currentY, pageWidth, pageHeight, margin, footerHeight, spacing, opts.textScale, errorMsg, addFooter, setName)
+			return true
 		}
 
 		var imageInfo *gofpdf.ImageInfoType
 		var finalImagePath string
 
-		if croppedImg != nil {
-			// Convert cropped image to bytes buffer for gofpdf
-			var buf bytes.Buffer
-			ext := strings.ToLower(filepath.Ext(imagePath))
-			switch ext {
-			case ".png":
-				err = png.Encode(&buf, croppedImg)
-			case ".jpg", ".jpeg":
-				err = jpeg.Encode(&buf, croppedImg, &jpeg.Options{Quality: 90})
-			default:
-				err = png.Encode(&buf, croppedImg) // Default to PNG
-			}
-
-			if err != nil {
-				log.Printf("%s: Warning: Could not encode cropped image %s: %v", gigFile, imagePath, err)
-				// Fall back to original file
-				imageInfo = pdf.RegisterImage(imagePath, "")
-				finalImagePath = imagePath
-			} else {
-				// Register the cropped image from bytes buffer
-				croppedImageName := fmt.Sprintf("cropped_%s", songName)
-				imageType := ""
-				switch ext {
-				case ".png":
-					imageType = "PNG"
-				case ".jpg", ".jpeg":
-					imageType = "JPG"
-				default:
-					imageType = "PNG"
-				}
-				imageInfo = pdf.RegisterImageReader(croppedImageName, imageType, &buf)
-				finalImagePath = croppedImageName
-			}
-		} else {
-			// Use original file
+		// Crop the image to remove white/transparent space and encode it for gofpdf
+		prepared, err := opts.images.get(imagePath, songName, opts.settingsFor(songMap, songName), opts.imageCache, out)
+		if err != nil {
+			out.Logf("%s: Warning: Could not crop image %s: %v", gigFile, imagePath, err)
+			// Fall back to original file
 			imageInfo = pdf.RegisterImage(imagePath, "")
 			finalImagePath = imagePath
+		} else {
+			// Register the cropped image from bytes buffer, reusing it if already registered in this PDF
+			if imageInfo = pdf.GetImageInfo(prepared.name); imageInfo != nil {
+				if debugMode {
+					out.Logf("[DEBUG] Image '%s' - reusing image already embedded for %s", songName, imagePath)
+				}
+			} else {
+				imageInfo = pdf.RegisterImageReader(prepared.name, prepared.imageType, bytes.NewReader(prepared.data))
+			}
+			finalImagePath = prepared.name
 		}
 		if imageInfo == nil {
-			log.Printf("%s: Warning: Could not process image: %s", gigFile, imagePath)
+			out.Logf("%s: Warning: Could not process image: %s", gigFile, imagePath)
 			return false
 		}
 
-		// Get natural image dimensions in points, then convert to mm
+		// Get natural image dimensions in points, then convert to mm. Downsampled images
+		// keep the layout of the cropped original (1 pixel = 1 point).
 		naturalWidth, naturalHeight := imageInfo.Extent()
+		if prepared != nil {
+			naturalWidth, naturalHeight = float64(prepared.width), float64(prepared.height)
+		}
 		// Convert from points to mm (1 point = 0.352778 mm)
 		imageWidth := naturalWidth * 0.352778
 		imageHeight := naturalHeight * 0.352778
 
+		if opts.profile != nil {
+			area := contentArea{x: margin, y: margin, width: availableWidth, height: pageHeight - footerHeight - 2*margin}
+			newPage := func(first bool) {
+				// The first page is reused if nothing has been drawn on it yet, e.g. at the start of a set
+				if !first || currentY > margin {
+					pdf.AddPage()
+					addFooter(setName)
+				}
+			}
+			drawMarginBand := func(y, height float64) {
+				if marginBandColor != nil {
+					pdf.SetFillColor(marginBandColor.r, marginBandColor.g, marginBandColor.b)
+					pdf.Rect(margin-marginBandRightGap-marginBandWidth, y, marginBandWidth, height, "F")
+				}
+			}
+			pages := renderSongPages(pdf, finalImagePath, imageWidth, imageHeight, area, opts.profile.halfPageTurn, newPage, drawMarginBand)
+			if debugMode {
+				out.Logf("[DEBUG] Image '%s' - %s layout: %d page(s)", songName, opts.profile.name, pages)
+			}
+			currentY = pageHeight // The next song starts on a new page
+			return true
+		}
+
 		// Calculate pixel dimensions (1 point = 1.333... pixels at 96 DPI)
 		imageWidthPx := int(naturalWidth * 1.333333)
 		imageHeightPx := int(naturalHeight * 1.333333)
 
-		// Only scale down if image is wider than available width
-		if imageWidth > availableWidth {
+		if opts.largePrint {
+			// Large print fills the width, enlarging small images, but never makes an image taller than a page
+			scale := availableWidth / imageWidth
+			maxHeight := pageHeight - footerHeight - 2*margin
+			if imageHeight*scale > maxHeight {
+				scale = maxHeight / imageHeight
+			}
+			if debugMode {
+				out.Logf("[DEBUG] Image '%s' - large print scaling: original=%.2fmm x %.2fmm, scale=%.4f, final=%.2fmm x %.2fmm",
+					songName, imageWidth, imageHeight, scale, imageWidth*scale, imageHeight*scale)
+			}
+			imageWidth *= scale
+			imageHeight *= scale
+		} else if imageWidth > availableWidth {
+			// Only scale down if image is wider than available width
 			scale := availableWidth / imageWidth
 			if debugMode {
-				log.Printf("[DEBUG] Image '%s' - scaling: original=%dx%d (%.2fmm x %.2fmm), scale=%.4f, final=%dx%d (%.2fmm x %.2fmm)",
+				out.Logf("[DEBUG] Image '%s' - scaling: original=%dx%d (%.2fmm x %.2fmm), scale=%.4f, final=%dx%d (%.2fmm x %.2fmm)",
 					songName, imageWidthPx, imageHeightPx, imageWidth, imageHeight, scale,
 					int(float64(imageWidthPx)*scale), int(float64(imageHeightPx)*scale), availableWidth, imageHeight*scale)
 			}
 			imageWidth = availableWidth
 			imageHeight *= scale
 		} else if debugMode {
-			log.Printf("[DEBUG] Image '%s' - no scaling needed: %dx%d (%.2fmm x %.2fmm), available width: %.2fmm",
+			out.Logf("[DEBUG] Image '%s' - no scaling needed: %dx%d (%.2fmm x %.2fmm), available width: %.2fmm",
 				songName, imageWidthPx, imageHeightPx, imageWidth, imageHeight, availableWidth)
 		} // Calculate available space on current page
 		remainingHeight := pageHeight - footerHeight - margin - currentY
@@ -937,6 +1270,13 @@ func generatePDF(config *Config, gig *Gig, outputPath string, imagesDir string,
 			currentY = margin
 		}
 
+		if bookmarks {
+			if setIndex == 0 {
+				pdf.Bookmark(gig.Name, 0, currentY)
+			}
+			pdf.Bookmark(set.Name, 1, currentY)
+		}
+
 		renderedAnyInSet := false
 		lastRenderedWasGroup := false
 
@@ -952,7 +1292,7 @@ func generatePDF(config *Config, gig *Gig, outputPath string, imagesDir string,
 				if strings.TrimSpace(item.Group.MarginColour) != "" {
 					parsedColor, err := parseHexColor(item.Group.MarginColour)
 					if err != nil {
-						log.Printf("%s: Warning: Invalid marginColour '%s' for group in set '%s': %v", gigFile, item.Group.MarginColour, set.Name, err)
+						out.Logf("%s: Warning: Invalid marginColour '%s' for group in set '%s': %v", gigFile, item.Group.MarginColour, set.Name, err)
 					} else {
 						groupMarginColor = parsedColor
 					}
@@ -982,12 +1322,4 @@ func generatePDF(config *Config, gig *Gig, outputPath string, imagesDir string,
 			}
 		}
 	}
-
-	// Save PDF
-	err := pdf.OutputFileAndClose(outputPath)
-	if err != nil {
-		return fmt.Errorf("failed to save PDF: %w", err)
-	}
-
-	return nil
 }
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setupGenerateTest writes a config file, gig files and a chart image to a temporary folder and
+// points the generate flags at them, restoring the flags when the test ends. It returns the
+// folder.
+func setupGenerateTest(t *testing.T, config string, gigs map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+
+	for _, folder := range []string{"images", "gigs"} {
+		if err := os.MkdirAll(filepath.Join(dir, folder), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A small black square on white, so that cropping has something to find
+	chart := image.NewGray(image.Rect(0, 0, 60, 40))
+	for i := range chart.Pix {
+		chart.Pix[i] = 255
+	}
+	for y := 10; y < 30; y++ {
+		for x := 10; x < 50; x++ {
+			chart.SetGray(x, y, color.Gray{})
+		}
+	}
+	file, err := os.Create(filepath.Join(dir, "images", "chart.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(file, chart); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	writeTestFile(t, filepath.Join(dir, "config.yaml"), config)
+	for name, content := range gigs {
+		writeTestFile(t, filepath.Join(dir, "gigs", name), content)
+	}
+
+	savedConfigFile, savedJobs, savedNoCache := configFile, jobsFlag, noCache
+	t.Cleanup(func() {
+		configFile, jobsFlag, noCache = savedConfigFile, savedJobs, savedNoCache
+	})
+	configFile = filepath.Join(dir, "config.yaml")
+	jobsFlag = 1
+	noCache = true
+	return dir
+}
+
+func writeTestFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+const testGenerateConfig = `imageFolder: images
+gigsFolder: gigs
+outputFolder: pdf
+songs:
+  - nickname: chart
+    image: chart.png
+`
+
+var testGenerateGigs = map[string]string{
+	"friday.yaml":   "name: Friday\nsets:\n  - name: Set 1\n    songs: [chart]\n",
+	"saturday.yaml": "name: Saturday\nsets:\n  - name: Set 1\n    songs: [chart]\n",
+}
+
+func TestGenerateAllGigsWithOutputClash(t *testing.T) {
+	dir := setupGenerateTest(t, testGenerateConfig+"outputPattern: same.pdf\n", testGenerateGigs)
+
+	if err := generateAllGigs(nil); err != nil {
+		t.Fatalf("generateAllGigs: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "pdf", "same.pdf")); err != nil {
+		t.Errorf("same.pdf was not generated: %v", err)
+	}
+}
+
+func TestGenerateAllGigsOnlySelected(t *testing.T) {
+	dir := setupGenerateTest(t, testGenerateConfig, testGenerateGigs)
+
+	only := map[string]bool{absolutePath(filepath.Join(dir, "gigs", "friday.yaml")): true}
+	if err := generateAllGigs(only); err != nil {
+		t.Fatalf("generateAllGigs: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "pdf", "friday.pdf")); err != nil {
+		t.Errorf("friday.pdf was not generated: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "pdf", "saturday.pdf")); !os.IsNotExist(err) {
+		t.Errorf("saturday.pdf was generated, but only friday.yaml was selected")
+	}
+}
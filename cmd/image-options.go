@@ -0,0 +1,288 @@
+package cmd
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ImageOptions are image processing overrides for a song, or for one of its images
+type ImageOptions struct {
+	Rotate     *int              `yaml:"rotate,omitempty"`     // Optional clockwise rotation: 90, 180 or 270 (0 undoes the song's rotation for a variant)
+	Flip       string            `yaml:"flip,omitempty"`       // Optional flip after rotating: horizontal, vertical, both or none
+	Crop       *CropConfig       `yaml:"crop,omitempty"`       // Optional cropping overrides
+	Preprocess *PreprocessConfig `yaml:"preprocess,omitempty"` // Optional pre-processing overrides
+	Compact    *CompactConfig    `yaml:"compact,omitempty"`    // Optional blank band compaction overrides
+	LargePrint *ImageOptions     `yaml:"largePrint,omitempty"` // Optional overrides for the large-print PDF only, e.g. a crop box around the lyrics
+}
+
+// CropConfig configures how images are cropped to their content. Unset fields keep the
+// value from the level above (config, then song, then variant).
+type CropConfig struct {
+	Enabled   *bool  `yaml:"enabled,omitempty"`   // Crop to the content (default: true)
+	Mode      string `yaml:"mode,omitempty"`      // exact (default): any non-background pixel is content; tolerant: ignore specks and dark scanner borders
+	Threshold *int   `yaml:"threshold,omitempty"` // 1-255: a pixel is background if every channel is at least this (default: 240)
+	NoiseSize *int   `yaml:"noiseSize,omitempty"` // tolerant mode: rows and columns with this many content pixels or fewer count as blank (default: from the image size)
+	Padding   string `yaml:"padding,omitempty"`   // White space kept around the content, e.g. "3mm" or "12px" (default: none)
+	Box       []int  `yaml:"box,omitempty"`       // Manual crop [left, top, right, bottom] in pixels, used instead of detecting the content
+}
+
+// CompactConfig configures collapsing of tall blank bands between the sections of a chart.
+// Unset fields keep the value from the level above (config, then song, then variant).
+type CompactConfig struct {
+	Enabled   *bool  `yaml:"enabled,omitempty"`   // Collapse blank bands (default: false)
+	MinHeight string `yaml:"minHeight,omitempty"` // Blank bands taller than this on the page are collapsed, e.g. "10mm" or "30px" (default: 10mm)
+	Gap       string `yaml:"gap,omitempty"`       // Height on the page collapsed bands are reduced to (default: 3mm)
+}
+
+const (
+	cropModeExact    = "exact"
+	cropModeTolerant = "tolerant"
+)
+
+// cropSettings are the resolved cropping settings for one image
+type cropSettings struct {
+	enabled   bool
+	mode      string
+	threshold uint8
+	noiseSize int // 0 = chosen from the image size
+	paddingPx int
+	box       image.Rectangle // Manual crop box; empty to detect the content
+}
+
+// compactSettings are the resolved blank band compaction settings for one image. Lengths in
+// mm are converted to pixels once the image's size, and so its scale on the page, is known.
+type compactSettings struct {
+	enabled   bool
+	minHeight length
+	gap       length
+}
+
+// length is a length such as "3mm" or "12px", kept in its own unit
+type length struct {
+	value float64
+	mm    bool
+}
+
+func (l length) String() string {
+	if l.mm {
+		return fmt.Sprintf("%gmm", l.value)
+	}
+	return fmt.Sprintf("%gpx", l.value)
+}
+
+// pixels converts the length to pixels of an image shown at mmPerPixel on the page
+func (l length) pixels(mmPerPixel float64) int {
+	if l.mm {
+		return int(math.Round(l.value / mmPerPixel))
+	}
+	return int(math.Round(l.value))
+}
+
+func defaultCropSettings() cropSettings {
+	return cropSettings{enabled: true, mode: cropModeExact, threshold: defaultBackgroundThreshold}
+}
+
+// key describes the settings for use in image store and cache keys
+func (c cropSettings) key() string {
+	return fmt.Sprintf("crop=%t;mode=%s;threshold=%d;noise=%d;padding=%d;box=%v", c.enabled, c.mode, c.threshold, c.noiseSize, c.paddingPx, c.box)
+}
+
+func defaultCompactSettings() compactSettings {
+	return compactSettings{minHeight: length{value: 10, mm: true}, gap: length{value: 3, mm: true}}
+}
+
+// key describes the settings for use in image store and cache keys
+func (c compactSettings) key() string {
+	return fmt.Sprintf("compact=%t;minHeight=%s;gap=%s", c.enabled, c.minHeight, c.gap)
+}
+
+// apply returns the settings with the overrides in config applied
+func (c compactSettings) apply(config *CompactConfig) (compactSettings, error) {
+	if config == nil {
+		return c, nil
+	}
+
+	if config.Enabled != nil {
+		c.enabled = *config.Enabled
+	}
+
+	if config.MinHeight != "" {
+		minHeight, err := parseLengthUnit(config.MinHeight)
+		if err != nil {
+			return c, fmt.Errorf("compact minHeight: %w", err)
+		}
+		c.minHeight = minHeight
+	}
+
+	if config.Gap != "" {
+		gap, err := parseLengthUnit(config.Gap)
+		if err != nil {
+			return c, fmt.Errorf("compact gap: %w", err)
+		}
+		c.gap = gap
+	}
+
+	// Lengths in different units can only be compared once the image's scale is known, so
+	// compactImage limits the gap to minHeight for those
+	if c.gap.mm == c.minHeight.mm && c.gap.value >= c.minHeight.value {
+		return c, fmt.Errorf("compact gap must be less than minHeight")
+	}
+	return c, nil
+}
+
+// apply returns the settings with the overrides in config applied. allowBox is false for the
+// config-wide settings, where a manual crop box makes no sense.
+func (c cropSettings) apply(config *CropConfig, allowBox bool) (cropSettings, error) {
+	if config == nil {
+		return c, nil
+	}
+
+	if config.Enabled != nil {
+		c.enabled = *config.Enabled
+	}
+
+	switch strings.ToLower(strings.TrimSpace(config.Mode)) {
+	case "":
+	case cropModeExact:
+		c.mode = cropModeExact
+	case cropModeTolerant:
+		c.mode = cropModeTolerant
+	default:
+		return c, fmt.Errorf("crop mode must be exact or tolerant, got '%s'", config.Mode)
+	}
+
+	if config.NoiseSize != nil {
+		if *config.NoiseSize < 0 {
+			return c, fmt.Errorf("crop noiseSize must not be negative")
+		}
+		c.noiseSize = *config.NoiseSize
+	}
+
+	if config.Threshold != nil {
+		if *config.Threshold < 1 || *config.Threshold > 255 {
+			return c, fmt.Errorf("crop threshold must be between 1 and 255")
+		}
+		c.threshold = uint8(*config.Threshold)
+	}
+
+	if config.Padding != "" {
+		padding, err := parseLength(config.Padding)
+		if err != nil {
+			return c, fmt.Errorf("crop padding: %w", err)
+		}
+		c.paddingPx = padding
+	}
+
+	if config.Box != nil {
+		if !allowBox {
+			return c, fmt.Errorf("crop box can only be set for a song or one of its images")
+		}
+		if len(config.Box) != 4 {
+			return c, fmt.Errorf("crop box must be [left, top, right, bottom]")
+		}
+		box := image.Rect(config.Box[0], config.Box[1], config.Box[2], config.Box[3])
+		if box.Min.X != config.Box[0] || box.Min.Y != config.Box[1] || box.Empty() || box.Min.X < 0 || box.Min.Y < 0 {
+			return c, fmt.Errorf("crop box must have left < right and top < bottom, all at least 0")
+		}
+		c.box = box
+	}
+
+	return c, nil
+}
+
+// parseLength parses a length such as "3mm", "12px" or "12" (pixels) into pixels.
+// Millimetres are converted at the 72 DPI images are laid out at.
+func parseLength(value string) (int, error) {
+	parsed, err := parseLengthUnit(value)
+	if err != nil {
+		return 0, err
+	}
+	return parsed.pixels(25.4 / 72), nil
+}
+
+// parseLengthUnit parses a length such as "3mm", "12px" or "12" (pixels), keeping its unit
+func parseLengthUnit(value string) (length, error) {
+	trimmed := strings.ToLower(strings.TrimSpace(value))
+	unitMM := strings.HasSuffix(trimmed, "mm")
+	trimmed = strings.TrimSpace(strings.TrimSuffix(strings.TrimSuffix(trimmed, "mm"), "px"))
+
+	number, err := strconv.ParseFloat(trimmed, 64)
+	if err != nil || number < 0 {
+		return length{}, fmt.Errorf("invalid length '%s' (expected e.g. 3mm or 12px)", value)
+	}
+	return length{value: number, mm: unitMM}, nil
+}
+
+// withOptions returns the settings with the overrides in options applied
+func (s imageSettings) withOptions(options *ImageOptions) (imageSettings, error) {
+	if options == nil {
+		return s, nil
+	}
+
+	orient, err := s.orient.apply(options)
+	if err != nil {
+		return s, err
+	}
+	s.orient = orient
+
+	crop, err := s.crop.apply(options.Crop, true)
+	if err != nil {
+		return s, err
+	}
+	s.crop = crop
+	s.preprocess = s.preprocess.apply(options.Preprocess)
+
+	compact, err := s.compact.apply(options.Compact)
+	if err != nil {
+		return s, err
+	}
+	s.compact = compact
+	return s, nil
+}
+
+// resolveSongImageSettings applies the per-song and per-variant overrides in the config to base.
+// The result is keyed by song nickname and then image name; songs without overrides are left out.
+// When largePrint is true, the song's and then the variant's largePrint overrides are applied last.
+func resolveSongImageSettings(config *Config, base imageSettings, largePrint bool) (map[string]map[string]imageSettings, error) {
+	songSettings := make(map[string]map[string]imageSettings)
+	songMap := buildSongMap(config)
+
+	for _, song := range config.Songs {
+		if song.ImageOptions == (ImageOptions{}) && len(song.Variants) == 0 {
+			continue
+		}
+
+		songLevel, err := base.withOptions(&song.ImageOptions)
+		if err != nil {
+			return nil, fmt.Errorf("song '%s': %w", song.Nickname, err)
+		}
+
+		for imageName := range song.Variants {
+			if _, exists := songMap[song.Nickname][imageName]; !exists {
+				return nil, fmt.Errorf("song '%s' has variant settings for unknown image '%s'", song.Nickname, imageName)
+			}
+		}
+
+		images := make(map[string]imageSettings)
+		for imageName := range songMap[song.Nickname] {
+			variant := song.Variants[imageName]
+			settings, err := songLevel.withOptions(variant)
+			if err == nil && largePrint {
+				settings, err = settings.withOptions(song.LargePrint)
+				if err == nil && variant != nil {
+					settings, err = settings.withOptions(variant.LargePrint)
+				}
+			}
+			if err != nil {
+				return nil, fmt.Errorf("song '%s' image '%s': %w", song.Nickname, imageName, err)
+			}
+			images[imageName] = settings
+		}
+		songSettings[song.Nickname] = images
+	}
+
+	return songSettings, nil
+}
@@ -0,0 +1,272 @@
+package cmd
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// ImageConfig configures how song images are processed after cropping
+type ImageConfig struct {
+	MaxDpi      float64 `yaml:"maxDpi,omitempty"`      // Downsample images shown at a higher resolution than this (0 = keep full resolution)
+	JpegQuality int     `yaml:"jpegQuality,omitempty"` // 1-100 (default: 90)
+	Colour      string  `yaml:"colour,omitempty"`      // colour (default), grayscale or bw (1-bit black and white)
+	BwThreshold int     `yaml:"bwThreshold,omitempty"` // Gray level below which a pixel becomes black in bw mode (default: 160)
+}
+
+const (
+	colourModeColour    = "colour"
+	colourModeGrayscale = "grayscale"
+	colourModeBW        = "bw"
+)
+
+// imageSettings holds everything that affects how a song image is prepared.
+// Images prepared with different settings are stored and cached separately.
+type imageSettings struct {
+	maxDpi         float64 // 0 = no downsampling
+	displayWidthMM float64 // Widest an image is shown on the page, used with maxDpi
+	jpegQuality    int
+	colourMode     string
+	bwThreshold    uint8
+	orient         orientSettings
+	crop           cropSettings
+	preprocess     preprocessSettings
+	compact        compactSettings
+	invert         bool // Invert colours for dark themes
+	fillWidth      bool // Images are enlarged to displayWidthMM if narrower (large print)
+}
+
+// resolveImageSettings applies defaults to the image section of the config
+func resolveImageSettings(config *Config, displayWidthMM float64) (imageSettings, error) {
+	settings := imageSettings{
+		displayWidthMM: displayWidthMM,
+		jpegQuality:    90,
+		colourMode:     colourModeColour,
+		bwThreshold:    160,
+		crop:           defaultCropSettings(),
+		compact:        defaultCompactSettings(),
+	}
+
+	crop, err := settings.crop.apply(config.Crop, false)
+	if err != nil {
+		return settings, err
+	}
+	settings.crop = crop
+	settings.preprocess = settings.preprocess.apply(config.Preprocess)
+
+	compact, err := settings.compact.apply(config.Compact)
+	if err != nil {
+		return settings, err
+	}
+	settings.compact = compact
+
+	imageConfig := config.Image
+	if imageConfig == nil {
+		return settings, nil
+	}
+
+	if imageConfig.MaxDpi < 0 {
+		return settings, fmt.Errorf("image maxDpi must not be negative")
+	}
+	settings.maxDpi = imageConfig.MaxDpi
+
+	if imageConfig.JpegQuality != 0 {
+		if imageConfig.JpegQuality < 1 || imageConfig.JpegQuality > 100 {
+			return settings, fmt.Errorf("image jpegQuality must be between 1 and 100")
+		}
+		settings.jpegQuality = imageConfig.JpegQuality
+	}
+
+	switch strings.ToLower(strings.TrimSpace(imageConfig.Colour)) {
+	case "", colourModeColour:
+	case colourModeGrayscale, "greyscale":
+		settings.colourMode = colourModeGrayscale
+	case colourModeBW:
+		settings.colourMode = colourModeBW
+	default:
+		return settings, fmt.Errorf("image colour must be colour, grayscale or bw, got '%s'", imageConfig.Colour)
+	}
+
+	if imageConfig.BwThreshold != 0 {
+		if imageConfig.BwThreshold < 1 || imageConfig.BwThreshold > 255 {
+			return settings, fmt.Errorf("image bwThreshold must be between 1 and 255")
+		}
+		settings.bwThreshold = uint8(imageConfig.BwThreshold)
+	}
+
+	return settings, nil
+}
+
+// key describes the settings for use in image store and cache keys
+func (s imageSettings) key(imageType string) string {
+	return fmt.Sprintf("%s;type=%s;%s;%s;%s;%s;jpegQuality=%d;maxDpi=%g;displayWidth=%g;fillWidth=%t;colour=%s;bwThreshold=%d;invert=%t",
+		cropSettingsVersion, imageType, s.orient.key(), s.preprocess.key(), s.crop.key(), s.compact.key(), s.jpegQuality, s.maxDpi, s.displayWidthMM, s.fillWidth, s.colourMode, s.bwThreshold, s.invert)
+}
+
+// downsample scales img down so that it is no more than maxDpi when shown on the page.
+// Images are laid out at 72 DPI and scaled down to displayWidthMM if wider, so the
+// resolution on the page depends on both. Images already within the limit are returned as-is.
+func (s imageSettings) downsample(img image.Image) image.Image {
+	if s.maxDpi <= 0 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	shownWidthMM := s.shownWidthMM(bounds.Dx())
+	targetWidth := int(math.Ceil(shownWidthMM / 25.4 * s.maxDpi))
+	if targetWidth <= 0 || targetWidth >= bounds.Dx() {
+		return img
+	}
+	targetHeight := max(1, int(math.Round(float64(bounds.Dy())*float64(targetWidth)/float64(bounds.Dx()))))
+
+	scaled := image.NewRGBA(image.Rect(0, 0, targetWidth, targetHeight))
+	draw.CatmullRom.Scale(scaled, scaled.Bounds(), img, bounds, draw.Src, nil)
+	return scaled
+}
+
+// shownWidthMM returns how wide an image the given number of pixels wide is shown on the page:
+// at 72 DPI, scaled down to displayWidthMM if wider, or enlarged to it with fillWidth
+func (s imageSettings) shownWidthMM(width int) float64 {
+	if s.fillWidth {
+		return s.displayWidthMM
+	}
+	return math.Min(float64(width)*25.4/72, s.displayWidthMM)
+}
+
+// convertColour converts img to grayscale or 1-bit black and white, flattening any
+// transparency onto white first
+func (s imageSettings) convertColour(img image.Image) image.Image {
+	if s.colourMode == colourModeColour {
+		return img
+	}
+
+	bounds := img.Bounds()
+	gray := image.NewGray(bounds)
+	draw.Draw(gray, bounds, image.White, image.Point{}, draw.Src)
+	draw.Draw(gray, bounds, img, bounds.Min, draw.Over)
+	if s.colourMode == colourModeGrayscale {
+		return gray
+	}
+
+	// A two colour palette is encoded as a 1-bit PNG
+	bw := image.NewPaletted(bounds, color.Palette{color.Black, color.White})
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if gray.Pix[gray.PixOffset(x, y)] >= s.bwThreshold {
+				bw.Pix[bw.PixOffset(x, y)] = 1
+			}
+		}
+	}
+	return bw
+}
+
+// invertColours inverts img for dark themes, so that black ink on white paper becomes light
+// ink on black. Transparency is flattened onto white first.
+func (s imageSettings) invertColours(img image.Image) image.Image {
+	if !s.invert {
+		return img
+	}
+
+	bounds := img.Bounds()
+	switch src := img.(type) {
+	case *image.Paletted:
+		// e.g. 1-bit black and white; inverting the palette keeps the encoding small
+		inverted := *src
+		inverted.Palette = make(color.Palette, len(src.Palette))
+		for i, c := range src.Palette {
+			r, g, b, a := c.RGBA()
+			inverted.Palette[i] = color.RGBA64{R: uint16(a - r), G: uint16(a - g), B: uint16(a - b), A: uint16(a)}
+		}
+		return &inverted
+
+	case *image.Gray:
+		inverted := image.NewGray(bounds)
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				inverted.Pix[inverted.PixOffset(x, y)] = 255 - src.Pix[src.PixOffset(x, y)]
+			}
+		}
+		return inverted
+	}
+
+	inverted := image.NewRGBA(bounds)
+	draw.Draw(inverted, bounds, image.White, image.Point{}, draw.Src)
+	draw.Draw(inverted, bounds, img, bounds.Min, draw.Over)
+	for i := 0; i < len(inverted.Pix); i += 4 {
+		inverted.Pix[i] = 255 - inverted.Pix[i]
+		inverted.Pix[i+1] = 255 - inverted.Pix[i+1]
+		inverted.Pix[i+2] = 255 - inverted.Pix[i+2]
+	}
+	return inverted
+}
+
+// imageType returns the gofpdf image type used to encode a prepared image: JPEG sources
+// stay JPEG (unless converted to 1-bit, which needs PNG) and everything else is PNG
+func (s imageSettings) imageType(imagePath string) string {
+	if s.colourMode != colourModeBW && imageTypeFor(imagePath) == "JPG" {
+		return "JPG"
+	}
+	return "PNG"
+}
+
+// reduced returns the settings for the given attempt at fitting a PDF within --max-size:
+// each attempt lowers JPEG quality by 10 (to a minimum of 30) and the resolution by 15%
+// (to a minimum of 72 DPI, starting from 300 DPI if no maxDpi is configured)
+func (s imageSettings) reduced(attempt int) imageSettings {
+	if attempt == 0 {
+		return s
+	}
+
+	reduced := s
+	reduced.jpegQuality = max(30, s.jpegQuality-10*attempt)
+
+	startDpi := s.maxDpi
+	if startDpi <= 0 {
+		startDpi = 300
+	}
+	reduced.maxDpi = math.Max(72, math.Round(startDpi*math.Pow(0.85, float64(attempt))))
+	return reduced
+}
+
+// reducible reports whether reduced(attempt+1) lowers the JPEG quality or resolution any further
+// than reduced(attempt)
+func (s imageSettings) reducible(attempt int) bool {
+	current, next := s.reduced(attempt), s.reduced(attempt+1)
+	return next.jpegQuality != current.jpegQuality || next.maxDpi != current.maxDpi
+}
+
+// parseByteSize parses sizes such as "500KB", "20MB", "1.5GB" or a plain number of bytes
+func parseByteSize(value string) (int64, error) {
+	trimmed := strings.ToUpper(strings.TrimSpace(value))
+	if trimmed == "" {
+		return 0, nil
+	}
+
+	multiplier := 1.0
+	for _, unit := range []struct {
+		suffix string
+		size   float64
+	}{
+		{"GB", 1024 * 1024 * 1024},
+		{"MB", 1024 * 1024},
+		{"KB", 1024},
+		{"B", 1},
+	} {
+		if strings.HasSuffix(trimmed, unit.suffix) {
+			multiplier = unit.size
+			trimmed = strings.TrimSpace(strings.TrimSuffix(trimmed, unit.suffix))
+			break
+		}
+	}
+
+	number, err := strconv.ParseFloat(trimmed, 64)
+	if err != nil || number <= 0 {
+		return 0, fmt.Errorf("invalid size '%s' (expected e.g. 500KB, 20MB)", value)
+	}
+	return int64(number * multiplier), nil
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+// jobOutput collects the console output of one job. Buffered output is held until
+// flush so that output from jobs running in parallel is written in a deterministic order.
+type jobOutput struct {
+	buffered bool
+	entries  []jobOutputEntry
+}
+
+type jobOutputEntry struct {
+	toLog bool // true for log output (stderr), false for normal output (stdout)
+	text  string
+}
+
+// directOutput writes straight to the console; used when nothing runs in parallel
+func directOutput() *jobOutput {
+	return &jobOutput{}
+}
+
+// Printf writes normal output, like fmt.Printf
+func (o *jobOutput) Printf(format string, args ...interface{}) {
+	if !o.buffered {
+		fmt.Printf(format, args...)
+		return
+	}
+	o.entries = append(o.entries, jobOutputEntry{text: fmt.Sprintf(format, args...)})
+}
+
+// Logf writes log output, like log.Printf
+func (o *jobOutput) Logf(format string, args ...interface{}) {
+	if !o.buffered {
+		log.Printf(format, args...)
+		return
+	}
+	o.entries = append(o.entries, jobOutputEntry{toLog: true, text: fmt.Sprintf(format, args...)})
+}
+
+func (o *jobOutput) flush() {
+	for _, entry := range o.entries {
+		if entry.toLog {
+			log.Print(entry.text)
+		} else {
+			fmt.Print(entry.text)
+		}
+	}
+	o.entries = nil
+}
+
+// runOrdered runs tasks on up to jobs goroutines. Each task's output is buffered and
+// written in task order as soon as that task and all earlier tasks have finished.
+func runOrdered(jobs int, tasks []func(out *jobOutput)) {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	outputs := make([]*jobOutput, len(tasks))
+	done := make([]chan struct{}, len(tasks))
+	for i := range tasks {
+		outputs[i] = &jobOutput{buffered: true}
+		done[i] = make(chan struct{})
+	}
+
+	// Workers take tasks in order so that early tasks (whose output is written first) start first
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(jobs, len(tasks)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				tasks[i](outputs[i])
+				close(done[i])
+			}
+		}()
+	}
+	go func() {
+		for i := range tasks {
+			next <- i
+		}
+		close(next)
+	}()
+
+	for i := range tasks {
+		<-done[i]
+		outputs[i].flush()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"fmt"
+)
+
+// LargePrintConfig configures the large-print copy of each PDF, for readers who need bigger charts
+type LargePrintConfig struct {
+	Enabled   bool    `yaml:"enabled,omitempty"`   // Also generate <gig>-large.pdf (--large-print enables it for one run)
+	TextScale float64 `yaml:"textScale,omitempty"` // Footer and message text size multiplier (default: 1.75)
+}
+
+// largePrintSuffix is added to the name of large-print PDFs, e.g. gig-large.pdf
+const largePrintSuffix = "-large"
+
+// resolveLargePrint returns the options for rendering large-print PDFs, or nil if they are not
+// enabled. Images fill the page width, and songs' largePrint overrides (e.g. a crop box around
+// the lyrics) are applied on top of their normal image settings.
+func resolveLargePrint(config *Config, opts *renderOptions) (*renderOptions, error) {
+	largePrint := config.LargePrint
+	if largePrint == nil {
+		largePrint = &LargePrintConfig{}
+	}
+	if !largePrint.Enabled && !largePrintFlag {
+		return nil, nil
+	}
+
+	textScale := 1.75
+	if largePrint.TextScale != 0 {
+		if largePrint.TextScale < 1 {
+			return nil, fmt.Errorf("largePrint textScale must be at least 1")
+		}
+		textScale = largePrint.TextScale
+	}
+
+	base := opts.imageSettings
+	base.fillWidth = true
+	songSettings, err := resolveSongImageSettings(config, base, true)
+	if err != nil {
+		return nil, fmt.Errorf("large print: %w", err)
+	}
+
+	large := *opts
+	large.largePrint = true
+	large.textScale = textScale
+	large.imageSettings = base
+	large.songSettings = songSettings
+	return &large, nil
+}
@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// MetadataConfig holds optional overrides for the PDF document properties
+type MetadataConfig struct {
+	Title    string   `yaml:"title,omitempty"`    // Overrides the gig name
+	Author   string   `yaml:"author,omitempty"`   // Band name
+	Subject  string   `yaml:"subject,omitempty"`  // Overrides the venue/date subject
+	Keywords []string `yaml:"keywords,omitempty"` // Overrides the song list
+	Creator  string   `yaml:"creator,omitempty"`  // Overrides "gigsheets <version>"
+}
+
+// pdfMetadata holds the resolved document properties written to a PDF
+type pdfMetadata struct {
+	title    string
+	author   string
+	subject  string
+	keywords []string
+	creator  string
+}
+
+// gigMetadata derives document properties from a gig, then applies any config overrides
+func gigMetadata(config *Config, gig *Gig) pdfMetadata {
+	subjectParts := make([]string, 0, 2)
+	if strings.TrimSpace(gig.Venue) != "" {
+		subjectParts = append(subjectParts, strings.TrimSpace(gig.Venue))
+	}
+	if strings.TrimSpace(gig.Date) != "" {
+		subjectParts = append(subjectParts, strings.TrimSpace(gig.Date))
+	}
+
+	meta := pdfMetadata{
+		title:    gig.Name,
+		subject:  strings.Join(subjectParts, " - "),
+		keywords: gigSongTitles(gig, nil),
+	}
+	return applyMetadataOverrides(config, meta)
+}
+
+// tourMetadata derives document properties for a combined tour PDF
+func tourMetadata(config *Config, tour *Tour, gigs []*Gig) pdfMetadata {
+	gigNames := make([]string, 0, len(gigs))
+	var keywords []string
+	for _, gig := range gigs {
+		gigNames = append(gigNames, gig.Name)
+		keywords = gigSongTitles(gig, keywords)
+	}
+
+	meta := pdfMetadata{
+		title:    tour.Name,
+		subject:  strings.Join(gigNames, ", "),
+		keywords: keywords,
+	}
+	return applyMetadataOverrides(config, meta)
+}
+
+// gigSongTitles appends the distinct song nicknames (without image variants) used in a gig to titles
+func gigSongTitles(gig *Gig, titles []string) []string {
+	seen := make(map[string]bool, len(titles))
+	for _, title := range titles {
+		seen[title] = true
+	}
+
+	add := func(songRef string) {
+		songName := strings.TrimSpace(strings.SplitN(songRef, "#", 2)[0])
+		if songName != "" && !seen[songName] {
+			seen[songName] = true
+			titles = append(titles, songName)
+		}
+	}
+
+	for _, set := range gig.Sets {
+		for _, item := range set.Songs {
+			if item.Group != nil {
+				for _, songRef := range item.Group.Songs {
+					add(songRef)
+				}
+			} else {
+				add(item.Song)
+			}
+		}
+	}
+	return titles
+}
+
+func applyMetadataOverrides(config *Config, meta pdfMetadata) pdfMetadata {
+	meta.creator = fmt.Sprintf("gigsheets %s", Version)
+
+	overrides := config.Metadata
+	if overrides == nil {
+		return meta
+	}
+	if overrides.Title != "" {
+		meta.title = overrides.Title
+	}
+	if overrides.Author != "" {
+		meta.author = overrides.Author
+	}
+	if overrides.Subject != "" {
+		meta.subject = overrides.Subject
+	}
+	if len(overrides.Keywords) > 0 {
+		meta.keywords = overrides.Keywords
+	}
+	if overrides.Creator != "" {
+		meta.creator = overrides.Creator
+	}
+	return meta
+}
+
+// applyPDFMetadata writes the document information dictionary and a matching XMP packet
+func applyPDFMetadata(pdf *gofpdf.Fpdf, meta pdfMetadata) {
+	now := time.Now()
+	pdf.SetCreationDate(now)
+	pdf.SetModificationDate(now)
+
+	pdf.SetTitle(meta.title, true)
+	pdf.SetAuthor(meta.author, true)
+	pdf.SetSubject(meta.subject, true)
+	pdf.SetKeywords(strings.Join(meta.keywords, ", "), true)
+	pdf.SetCreator(meta.creator, true)
+
+	pdf.SetXmpMetadata(buildXMP(meta, now))
+}
+
+// buildXMP creates an XMP metadata packet mirroring the document information dictionary,
+// which is what most tablet library apps read in preference to the info dictionary
+func buildXMP(meta pdfMetadata, created time.Time) []byte {
+	escape := func(value string) string {
+		var buf bytes.Buffer
+		_ = xml.EscapeText(&buf, []byte(value))
+		return buf.String()
+	}
+	timestamp := created.Format(time.RFC3339)
+
+	var xmp strings.Builder
+	xmp.WriteString(`<?xpacket begin="` + "\uFEFF" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>` + "\n")
+	xmp.WriteString(`<x:xmpmeta xmlns:x="adobe:ns:meta/">` + "\n")
+	xmp.WriteString(`<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` + "\n")
+	xmp.WriteString(`<rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:pdf="http://ns.adobe.com/pdf/1.3/" xmlns:xmp="http://ns.adobe.com/xap/1.0/">` + "\n")
+	xmp.WriteString(`<dc:format>application/pdf</dc:format>` + "\n")
+	if meta.title != "" {
+		xmp.WriteString(`<dc:title><rdf:Alt><rdf:li xml:lang="x-default">` + escape(meta.title) + `</rdf:li></rdf:Alt></dc:title>` + "\n")
+	}
+	if meta.author != "" {
+		xmp.WriteString(`<dc:creator><rdf:Seq><rdf:li>` + escape(meta.author) + `</rdf:li></rdf:Seq></dc:creator>` + "\n")
+	}
+	if meta.subject != "" {
+		xmp.WriteString(`<dc:description><rdf:Alt><rdf:li xml:lang="x-default">` + escape(meta.subject) + `</rdf:li></rdf:Alt></dc:description>` + "\n")
+	}
+	if len(meta.keywords) > 0 {
+		xmp.WriteString(`<dc:subject><rdf:Bag>`)
+		for _, keyword := range meta.keywords {
+			xmp.WriteString(`<rdf:li>` + escape(keyword) + `</rdf:li>`)
+		}
+		xmp.WriteString(`</rdf:Bag></dc:subject>` + "\n")
+		xmp.WriteString(`<pdf:Keywords>` + escape(strings.Join(meta.keywords, ", ")) + `</pdf:Keywords>` + "\n")
+	}
+	xmp.WriteString(`<xmp:CreatorTool>` + escape(meta.creator) + `</xmp:CreatorTool>` + "\n")
+	xmp.WriteString(`<xmp:CreateDate>` + timestamp + `</xmp:CreateDate>` + "\n")
+	xmp.WriteString(`<xmp:ModifyDate>` + timestamp + `</xmp:ModifyDate>` + "\n")
+	xmp.WriteString(`</rdf:Description>` + "\n")
+	xmp.WriteString(`</rdf:RDF>` + "\n")
+	xmp.WriteString(`</x:xmpmeta>` + "\n")
+	xmp.WriteString(`<?xpacket end="w"?>`)
+
+	return []byte(xmp.String())
+}
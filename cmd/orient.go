@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// orientSettings are the resolved rotation and flips for one image
+type orientSettings struct {
+	rotate         int // Clockwise degrees: 0, 90, 180 or 270
+	flipHorizontal bool
+	flipVertical   bool
+}
+
+// key describes the settings for use in image store and cache keys
+func (o orientSettings) key() string {
+	return fmt.Sprintf("rotate=%d;flipH=%t;flipV=%t", o.rotate, o.flipHorizontal, o.flipVertical)
+}
+
+// apply returns the settings with the rotation and flip in options applied
+func (o orientSettings) apply(options *ImageOptions) (orientSettings, error) {
+	if options.Rotate != nil {
+		switch *options.Rotate {
+		case 0, 90, 180, 270:
+			o.rotate = *options.Rotate
+		default:
+			return o, fmt.Errorf("rotate must be 0, 90, 180 or 270, got %d", *options.Rotate)
+		}
+	}
+
+	switch strings.ToLower(strings.TrimSpace(options.Flip)) {
+	case "":
+	case "none":
+		o.flipHorizontal, o.flipVertical = false, false
+	case "horizontal":
+		o.flipHorizontal, o.flipVertical = true, false
+	case "vertical":
+		o.flipHorizontal, o.flipVertical = false, true
+	case "both":
+		o.flipHorizontal, o.flipVertical = true, true
+	default:
+		return o, fmt.Errorf("flip must be horizontal, vertical, both or none, got '%s'", options.Flip)
+	}
+	return o, nil
+}
+
+// size returns the size of an image of the given size once oriented
+func (o orientSettings) size(width, height int) (int, int) {
+	if o.rotate == 90 || o.rotate == 270 {
+		return height, width
+	}
+	return width, height
+}
+
+// orientImage rotates img clockwise and then flips it as configured. img is returned as-is
+// if there is nothing to do.
+func orientImage(img image.Image, songName string, orient orientSettings, out *jobOutput) image.Image {
+	if orient == (orientSettings{}) {
+		return img
+	}
+
+	bounds := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	width, height := bounds.Dx(), bounds.Dy()
+	dstWidth, dstHeight := orient.size(width, height)
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+
+	for y := range height {
+		for x := range width {
+			dx, dy := x, y
+			switch orient.rotate {
+			case 90:
+				dx, dy = height-1-y, x
+			case 180:
+				dx, dy = width-1-x, height-1-y
+			case 270:
+				dx, dy = y, width-1-x
+			}
+			if orient.flipHorizontal {
+				dx = dstWidth - 1 - dx
+			}
+			if orient.flipVertical {
+				dy = dstHeight - 1 - dy
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):dst.PixOffset(dx, dy)+4], src.Pix[src.PixOffset(x, y):src.PixOffset(x, y)+4])
+		}
+	}
+
+	if debugMode {
+		out.Logf("[DEBUG] Image '%s' - oriented (%s): %dx%d -> %dx%d", songName, orient.key(), width, height, dstWidth, dstHeight)
+	}
+	return dst
+}
+
+// looksSideways reports whether an image of the given size (once oriented) looks like a whole
+// page scanned or photographed sideways: landscape, at least 1000 pixels on its shorter side,
+// and within 10% of the page's proportions turned on its side
+func looksSideways(width, height int) bool {
+	if width <= height || height < 1000 {
+		return false
+	}
+	pageWidth, pageHeight := newGigPDF().GetPageSize()
+	sidewaysRatio := pageHeight / pageWidth
+	return math.Abs(float64(width)/float64(height)/sidewaysRatio-1) < 0.1
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// defaultOutputPattern reproduces the original naming of one PDF per gig file
+const defaultOutputPattern = "{{.File}}.pdf"
+
+// outputNameData holds the values available to the outputPattern template
+type outputNameData struct {
+	File    string // Gig file name without extension
+	Name    string // Gig name from the gig file
+	Date    string // Gig date as written in the gig file
+	Year    string // Year parsed from Date (empty if Date is not YYYY-MM-DD)
+	Venue   string // Gig venue
+	Profile string // Image override in use (empty if none)
+}
+
+// newOutputNameData builds the template values for a gig, sanitising each
+// value so it can be used as (part of) a single path component
+func newOutputNameData(gig *Gig, gigFile string, profile string) outputNameData {
+	gigBasename := filepath.Base(gigFile)
+	data := outputNameData{
+		File:    sanitizePathComponent(strings.TrimSuffix(gigBasename, filepath.Ext(gigBasename))),
+		Name:    sanitizePathComponent(gig.Name),
+		Date:    sanitizePathComponent(gig.Date),
+		Venue:   sanitizePathComponent(gig.Venue),
+		Profile: sanitizePathComponent(profile),
+	}
+
+	if parsed, err := time.Parse("2006-01-02", strings.TrimSpace(gig.Date)); err == nil {
+		data.Year = parsed.Format("2006")
+	}
+
+	return data
+}
+
+// sanitizePathComponent replaces characters that are not valid in file names
+// so that values such as a venue name cannot introduce extra directories
+func sanitizePathComponent(value string) string {
+	replacer := strings.NewReplacer(
+		"/", "-",
+		"\\", "-",
+		":", "-",
+		"*", "-",
+		"?", "-",
+		"\"", "-",
+		"<", "-",
+		">", "-",
+		"|", "-",
+	)
+	return strings.TrimSpace(replacer.Replace(value))
+}
+
+// parseOutputPattern parses the outputPattern from config, falling back to the default
+func parseOutputPattern(config *Config) (*template.Template, error) {
+	pattern := strings.TrimSpace(config.OutputPattern)
+	if pattern == "" {
+		pattern = defaultOutputPattern
+	}
+
+	tmpl, err := template.New("outputPattern").Option("missingkey=error").Parse(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid outputPattern %q: %w", pattern, err)
+	}
+	return tmpl, nil
+}
+
+// resolveOutputPath renders the output pattern and returns the full PDF path within outputDir.
+// Slashes in the pattern itself create sub-directories; empty directory levels (for example
+// when a gig has no venue) are skipped and the rendered path must stay inside outputDir.
+func resolveOutputPath(tmpl *template.Template, outputDir string, data outputNameData) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render outputPattern: %w", err)
+	}
+
+	var parts []string
+	for _, part := range strings.Split(filepath.ToSlash(buf.String()), "/") {
+		part = strings.TrimSpace(part)
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			return "", fmt.Errorf("outputPattern must produce a path inside the output folder, got %q", buf.String())
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) == 0 {
+		return "", fmt.Errorf("outputPattern rendered an empty file name")
+	}
+
+	relPath := filepath.Join(parts...)
+	if !strings.EqualFold(filepath.Ext(relPath), ".pdf") {
+		relPath += ".pdf"
+	}
+
+	return filepath.Join(outputDir, relPath), nil
+}
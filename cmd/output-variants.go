@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// outputVariant is one version of every PDF, e.g. the normal PDF or its dark or large-print copy
+type outputVariant struct {
+	suffix string // Added to the output file name before the extension
+	name   string // Describes the variant in messages, e.g. "large print, dark theme"; empty for the normal PDF
+	opts   *renderOptions
+}
+
+// resolveOutputVariants returns every version of each PDF to generate: the normal PDF and, if
+// enabled, its large-print copy and one per tablet profile, each in every selected theme
+// (e.g. gig.pdf, gig-dark.pdf, gig-large.pdf, gig-ipad.pdf and gig-ipad-dark.pdf)
+func resolveOutputVariants(config *Config, opts *renderOptions) ([]outputVariant, error) {
+	themes, err := resolveThemes(config)
+	if err != nil {
+		return nil, err
+	}
+
+	layouts := []outputVariant{{opts: opts}}
+	largePrint, err := resolveLargePrint(config, opts)
+	if err != nil {
+		return nil, err
+	}
+	if largePrint != nil {
+		layouts = append(layouts, outputVariant{suffix: largePrintSuffix, name: "large print", opts: largePrint})
+	}
+	profiles, err := resolveProfiles(config, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, profile := range profiles {
+		layouts = append(layouts, outputVariant{suffix: "-" + profile.profile.name, name: fmt.Sprintf("'%s' profile", profile.profile.name), opts: profile})
+	}
+
+	var variants []outputVariant
+	for _, layout := range layouts {
+		for _, theme := range themes {
+			name := layout.name
+			if theme.suffix != "" {
+				name = strings.TrimPrefix(name+", "+theme.name+" theme", ", ")
+			}
+			variants = append(variants, outputVariant{suffix: layout.suffix + theme.suffix, name: name, opts: layout.opts.withTheme(theme)})
+		}
+	}
+	return variants, nil
+}
+
+// outputPath adds the variant's suffix to outputPath, e.g. gig.pdf becomes gig-dark.pdf
+func (v outputVariant) outputPath(outputPath string) string {
+	if v.suffix == "" {
+		return outputPath
+	}
+	ext := filepath.Ext(outputPath)
+	return strings.TrimSuffix(outputPath, ext) + v.suffix + ext
+}
+
+// description names the variant in messages, e.g. "normal" or "large print, dark theme"
+func (v outputVariant) description() string {
+	if v.name == "" {
+		return "normal"
+	}
+	return v.name
+}
+
+// variantClashWarning is the warning shown when two variants of a PDF map to the same file and
+// only the later one is generated
+func variantClashWarning(previous outputVariant, variant outputVariant, file string) string {
+	return fmt.Sprintf("Warning: the %s and %s copies both map to %s; only the %s copy is generated",
+		previous.description(), variant.description(), file, variant.description())
+}
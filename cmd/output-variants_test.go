@@ -0,0 +1,22 @@
+package cmd
+
+import "testing"
+
+func TestVariantClashWarning(t *testing.T) {
+	normal := outputVariant{}
+	largeDark := outputVariant{suffix: "-large-dark", name: "large print, dark theme"}
+	profile := outputVariant{suffix: "-large-dark", name: "'large-dark' profile"}
+
+	for _, test := range []struct {
+		previous, variant outputVariant
+		want              string
+	}{
+		{normal, largeDark, "Warning: the normal and large print, dark theme copies both map to tour.pdf; only the large print, dark theme copy is generated"},
+		{largeDark, normal, "Warning: the large print, dark theme and normal copies both map to tour.pdf; only the normal copy is generated"},
+		{largeDark, profile, "Warning: the large print, dark theme and 'large-dark' profile copies both map to tour.pdf; only the 'large-dark' profile copy is generated"},
+	} {
+		if got := variantClashWarning(test.previous, test.variant, "tour.pdf"); got != test.want {
+			t.Errorf("variantClashWarning(%q, %q) = %q, want %q", test.previous.name, test.variant.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"gigsheets/internal/pkg/imagecache"
+)
+
+// cropSettingsVersion must be changed whenever the cropping or encoding output changes,
+// so that stale cache entries are not reused
+const cropSettingsVersion = "crop-v1"
+
+// preparedImage is a cropped song image encoded ready to register with gofpdf
+type preparedImage struct {
+	name      string // Name to register with gofpdf; the same for every use of this image and settings
+	data      []byte
+	imageType string // gofpdf image type: "PNG" or "JPG"
+	width     int    // Cropped size in pixels before any downsampling, used for layout
+	height    int
+}
+
+// imageStore holds the images prepared during one generation run, keyed by image path and
+// crop settings, so that each image is cropped and encoded at most once however many PDFs
+// (or songs within a PDF) use it
+type imageStore struct {
+	mu     sync.Mutex
+	images map[string]*storedImage
+}
+
+type storedImage struct {
+	once     sync.Once
+	prepared *preparedImage
+	err      error
+}
+
+// imageRequest identifies an image to prepare; songName is only used in log messages
+type imageRequest struct {
+	imagePath string
+	songName  string
+	settings  imageSettings
+}
+
+func newImageStore() *imageStore {
+	return &imageStore{images: make(map[string]*storedImage)}
+}
+
+// get returns the prepared image for imagePath, preparing it if this is the first request.
+// Concurrent requests for the same image wait for a single preparation.
+func (s *imageStore) get(imagePath string, songName string, settings imageSettings, imageCache *imagecache.Cache, out *jobOutput) (*preparedImage, error) {
+	key := imagePath + "|" + settings.key(settings.imageType(imagePath))
+
+	s.mu.Lock()
+	stored, exists := s.images[key]
+	if !exists {
+		stored = &storedImage{}
+		s.images[key] = stored
+	}
+	s.mu.Unlock()
+
+	stored.once.Do(func() {
+		stored.prepared, stored.err = prepareImage(imagePath, songName, settings, imageCache, out)
+		if stored.prepared != nil {
+			// Registering under a name derived from the key means a song that appears more than
+			// once (or under several references) is embedded as a single image object
+			stored.prepared.name = "cropped_" + key
+		}
+	})
+	return stored.prepared, stored.err
+}
+
+// prepareAll prepares the requested images on up to jobs goroutines ahead of rendering.
+// Errors are kept in the store and reported when the image is rendered.
+func (s *imageStore) prepareAll(requests []imageRequest, jobs int, imageCache *imagecache.Cache) {
+	seen := make(map[string]bool)
+	var tasks []func(out *jobOutput)
+	for _, request := range requests {
+		key := request.imagePath + "|" + request.settings.key(request.settings.imageType(request.imagePath))
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		tasks = append(tasks, func(out *jobOutput) {
+			_, _ = s.get(request.imagePath, request.songName, request.settings, imageCache, out)
+		})
+	}
+	runOrdered(jobs, tasks)
+}
+
+// gigImageRequests lists the images needed to render a gig, skipping unresolvable songs
+func gigImageRequests(songMap map[string]map[string]string, gig *Gig, opts *renderOptions) []imageRequest {
+	var requests []imageRequest
+	for _, songRef := range gigSongRefs(gig) {
+		imagePath, err := resolveSongImage(songMap, songRef, opts.imageOverride, opts.imagesDir)
+		if err != nil {
+			continue
+		}
+		requests = append(requests, imageRequest{imagePath: imagePath, songName: songRef, settings: opts.settingsFor(songMap, songRef)})
+	}
+	return requests
+}
+
+// prepareImage loads an image, then orients, pre-processes, crops, compacts, downsamples and
+// encodes it for the PDF. When imageCache is set, results are looked up and stored by the hash of
+// the file contents and image settings.
+func prepareImage(imagePath string, songName string, settings imageSettings, imageCache *imagecache.Cache, out *jobOutput) (*preparedImage, error) {
+	data, err := os.ReadFile(imagePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image: %w", err)
+	}
+
+	ext := strings.ToLower(filepath.Ext(imagePath))
+	imageType := settings.imageType(imagePath)
+
+	cacheKey := ""
+	if imageCache != nil {
+		cacheKey = imagecache.Key(data, settings.key(imageType))
+		if entry, ok := imageCache.Get(cacheKey); ok {
+			if debugMode {
+				out.Logf("[DEBUG] Image '%s' - using cached crop %v", songName, entry.Bounds)
+			}
+			return &preparedImage{data: entry.Data, imageType: entry.ImageType, width: entry.Bounds.Dx(), height: entry.Bounds.Dy()}, nil
+		}
+	}
+
+	img, err := decodeImage(data, ext)
+	if err != nil {
+		return nil, err
+	}
+
+	img = orientImage(img, songName, settings.orient, out)
+	img = preprocessImage(img, songName, settings.preprocess, out)
+	croppedImg, cropBounds := cropImage(img, songName, settings.crop, out)
+	croppedImg = compactImage(croppedImg, songName, settings, out)
+
+	// Compacting removes rows, so the bounds used for layout are shortened to match
+	cropBounds.Max = cropBounds.Min.Add(croppedImg.Bounds().Size())
+
+	finalImg := settings.invertColours(settings.convertColour(settings.downsample(croppedImg)))
+	if debugMode && finalImg.Bounds().Dx() != croppedImg.Bounds().Dx() {
+		out.Logf("[DEBUG] Image '%s' - downsampled to %dx%d for %g DPI", songName, finalImg.Bounds().Dx(), finalImg.Bounds().Dy(), settings.maxDpi)
+	}
+
+	// Convert cropped image to bytes buffer for gofpdf
+	var buf bytes.Buffer
+	if imageType == "JPG" {
+		err = jpeg.Encode(&buf, finalImg, &jpeg.Options{Quality: settings.jpegQuality})
+	} else {
+		err = png.Encode(&buf, finalImg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode cropped image: %w", err)
+	}
+
+	prepared := &preparedImage{data: buf.Bytes(), imageType: imageType, width: cropBounds.Dx(), height: cropBounds.Dy()}
+
+	if imageCache != nil {
+		err = imageCache.Put(cacheKey, &imagecache.Entry{
+			ImageType: imageType,
+			Bounds:    cropBounds,
+			Source:    imagePath,
+			Data:      prepared.data,
+		})
+		if err != nil {
+			out.Logf("Warning: could not cache cropped image %s: %v", imagePath, err)
+		}
+	}
+
+	return prepared, nil
+}
+
+// imageTypeFor returns the gofpdf image type used to encode a prepared image: JPEG sources
+// stay JPEG and everything else is encoded as PNG
+func imageTypeFor(imagePath string) string {
+	ext := strings.ToLower(filepath.Ext(imagePath))
+	if ext == ".jpg" || ext == ".jpeg" {
+		return "JPG"
+	}
+	return "PNG"
+}
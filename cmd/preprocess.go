@@ -0,0 +1,283 @@
+package cmd
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/math/f64"
+)
+
+// PreprocessConfig configures clean-up of photographed or scanned charts before they are cropped.
+// Unset fields keep the value from the level above (config, then song, then variant).
+type PreprocessConfig struct {
+	Deskew    *bool `yaml:"deskew,omitempty"`    // Straighten images rotated by up to 5 degrees (default: false)
+	Levels    *bool `yaml:"levels,omitempty"`    // Stretch the contrast so the ink is black and the paper white (default: false)
+	Whiten    *bool `yaml:"whiten,omitempty"`    // Even out uneven lighting so the paper is white throughout (default: false)
+	Grayscale *bool `yaml:"grayscale,omitempty"` // Convert to grayscale (default: false)
+}
+
+// preprocessSettings are the resolved pre-processing steps for one image
+type preprocessSettings struct {
+	deskew    bool
+	levels    bool
+	whiten    bool
+	grayscale bool
+}
+
+// maxSkewDegrees is the largest rotation deskewing looks for
+const maxSkewDegrees = 5.0
+
+func (p preprocessSettings) enabled() bool {
+	return p.deskew || p.levels || p.whiten || p.grayscale
+}
+
+// key describes the settings for use in image store and cache keys
+func (p preprocessSettings) key() string {
+	return fmt.Sprintf("deskew=%t;levels=%t;whiten=%t;grayscale=%t", p.deskew, p.levels, p.whiten, p.grayscale)
+}
+
+// apply returns the settings with the overrides in config applied
+func (p preprocessSettings) apply(config *PreprocessConfig) preprocessSettings {
+	if config == nil {
+		return p
+	}
+	if config.Deskew != nil {
+		p.deskew = *config.Deskew
+	}
+	if config.Levels != nil {
+		p.levels = *config.Levels
+	}
+	if config.Whiten != nil {
+		p.whiten = *config.Whiten
+	}
+	if config.Grayscale != nil {
+		p.grayscale = *config.Grayscale
+	}
+	return p
+}
+
+// preprocessImage runs the enabled steps on img in a fixed order: whitening, auto-levels, deskewing
+// and grayscale conversion. Transparency is flattened onto white. img is returned as-is if no step is enabled.
+func preprocessImage(img image.Image, songName string, pre preprocessSettings, out *jobOutput) image.Image {
+	if !pre.enabled() {
+		return img
+	}
+
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Over)
+
+	if pre.whiten {
+		whitenBackground(rgba)
+	}
+
+	if pre.levels {
+		low, high, ok := autoLevels(rgba)
+		if debugMode {
+			if ok {
+				out.Logf("[DEBUG] Image '%s' - levels stretched from %d-%d to 0-255", songName, low, high)
+			} else {
+				out.Logf("[DEBUG] Image '%s' - too little contrast for auto-levels", songName)
+			}
+		}
+	}
+
+	if pre.deskew {
+		angle := detectSkew(rgba)
+		if math.Abs(angle) >= 0.05 {
+			rgba = rotateImage(rgba, angle)
+		}
+		if debugMode {
+			out.Logf("[DEBUG] Image '%s' - deskewed by %.2f degrees", songName, angle)
+		}
+	}
+
+	if pre.grayscale {
+		gray := image.NewGray(rgba.Bounds())
+		draw.Draw(gray, gray.Bounds(), rgba, image.Point{}, draw.Src)
+		return gray
+	}
+	return rgba
+}
+
+// luminance returns the gray level of an 8-bit RGB colour
+func luminance(r, g, b uint8) uint8 {
+	return uint8((299*uint32(r) + 587*uint32(g) + 114*uint32(b) + 500) / 1000)
+}
+
+// whitenBackground evens out uneven lighting by estimating the paper brightness across the image
+// and scaling every pixel so that the paper becomes white. The paper brightness is the 90th
+// percentile of each block of a grid, raised to the brightest neighbouring block so that blocks
+// covered mostly in ink are not mistaken for shadow.
+func whitenBackground(img *image.RGBA) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	block := max(8, max(width, height)/32)
+	gridW, gridH := (width+block-1)/block, (height+block-1)/block
+
+	grid := make([]float64, gridW*gridH)
+	for gy := range gridH {
+		for gx := range gridW {
+			var histogram [256]int
+			area := image.Rect(gx*block, gy*block, min((gx+1)*block, width), min((gy+1)*block, height))
+			for y := area.Min.Y; y < area.Max.Y; y++ {
+				row := img.Pix[y*img.Stride:]
+				for x := area.Min.X; x < area.Max.X; x++ {
+					histogram[luminance(row[x*4], row[x*4+1], row[x*4+2])]++
+				}
+			}
+			grid[gy*gridW+gx] = float64(max(1, histogramPercentile(histogram, area.Dx()*area.Dy(), 0.9)))
+		}
+	}
+
+	paper := make([]float64, len(grid))
+	for gy := range gridH {
+		for gx := range gridW {
+			brightest := 0.0
+			for ny := max(0, gy-1); ny <= min(gridH-1, gy+1); ny++ {
+				for nx := max(0, gx-1); nx <= min(gridW-1, gx+1); nx++ {
+					brightest = math.Max(brightest, grid[ny*gridW+nx])
+				}
+			}
+			paper[gy*gridW+gx] = brightest
+		}
+	}
+
+	// Interpolate between block centres so that no block edges are visible
+	gridPosition := func(pixel, cells int) (int, int, float64) {
+		position := math.Max(0, math.Min(float64(cells-1), (float64(pixel)+0.5)/float64(block)-0.5))
+		low := int(position)
+		return low, min(low+1, cells-1), position - float64(low)
+	}
+	for y := range height {
+		y0, y1, ty := gridPosition(y, gridH)
+		row := img.Pix[y*img.Stride:]
+		for x := range width {
+			x0, x1, tx := gridPosition(x, gridW)
+			top := paper[y0*gridW+x0]*(1-tx) + paper[y0*gridW+x1]*tx
+			bottom := paper[y1*gridW+x0]*(1-tx) + paper[y1*gridW+x1]*tx
+			scale := math.Max(1, 255/(top*(1-ty)+bottom*ty))
+			for c := range 3 {
+				row[x*4+c] = uint8(math.Min(255, float64(row[x*4+c])*scale))
+			}
+		}
+	}
+}
+
+// autoLevels stretches the contrast so that the darkest 1% of pixels become black and the
+// brightest 5% white. It returns the levels that were stretched, and false if the image has too
+// little contrast to stretch (e.g. a blank page).
+func autoLevels(img *image.RGBA) (uint8, uint8, bool) {
+	bounds := img.Bounds()
+	var histogram [256]int
+	for y := range bounds.Dy() {
+		row := img.Pix[y*img.Stride:]
+		for x := range bounds.Dx() {
+			histogram[luminance(row[x*4], row[x*4+1], row[x*4+2])]++
+		}
+	}
+
+	total := bounds.Dx() * bounds.Dy()
+	low := histogramPercentile(histogram, total, 0.01)
+	high := histogramPercentile(histogram, total, 0.95)
+	if int(high)-int(low) < 32 {
+		return low, high, false
+	}
+
+	var levels [256]uint8
+	for value := range levels {
+		stretched := (float64(value) - float64(low)) * 255 / (float64(high) - float64(low))
+		levels[value] = uint8(math.Round(math.Max(0, math.Min(255, stretched))))
+	}
+	for y := range bounds.Dy() {
+		row := img.Pix[y*img.Stride:]
+		for x := range bounds.Dx() {
+			for c := range 3 {
+				row[x*4+c] = levels[row[x*4+c]]
+			}
+		}
+	}
+	return low, high, true
+}
+
+// histogramPercentile returns the lowest level with at least fraction of the total pixels at or below it
+func histogramPercentile(histogram [256]int, total int, fraction float64) uint8 {
+	target := int(math.Ceil(float64(total) * fraction))
+	count := 0
+	for level, n := range histogram {
+		count += n
+		if count >= target {
+			return uint8(level)
+		}
+	}
+	return 255
+}
+
+// detectSkew finds the rotation in degrees that straightens img, using projection profiles: the
+// dark pixels are projected onto the vertical axis at each candidate angle, and the angle at which
+// staff lines and text rows line up best (the sum of squared row counts is highest) is chosen.
+// Large images are sampled, as the angle only needs to be accurate to a twentieth of a degree.
+func detectSkew(img *image.RGBA) float64 {
+	bounds := img.Bounds()
+	step := max(1, max(bounds.Dx(), bounds.Dy())/1000)
+	centreX, centreY := float64(bounds.Dx())/2, float64(bounds.Dy())/2
+
+	var points [][2]float64
+	for y := 0; y < bounds.Dy(); y += step {
+		row := img.Pix[y*img.Stride:]
+		for x := 0; x < bounds.Dx(); x += step {
+			if luminance(row[x*4], row[x*4+1], row[x*4+2]) < 128 {
+				points = append(points, [2]float64{(float64(x) - centreX) / float64(step), (float64(y) - centreY) / float64(step)})
+			}
+		}
+	}
+	if len(points) < 100 {
+		return 0
+	}
+
+	offset := math.Hypot(centreX, centreY)/float64(step) + 1
+	counts := make([]int, int(2*offset)+1)
+	score := func(degrees float64) float64 {
+		clear(counts)
+		sin, cos := math.Sincos(degrees * math.Pi / 180)
+		for _, point := range points {
+			counts[int(point[0]*sin+point[1]*cos+offset)]++
+		}
+		total := 0.0
+		for _, count := range counts {
+			total += float64(count) * float64(count)
+		}
+		return total
+	}
+
+	best, bestScore := 0.0, score(0)
+	search := func(from, to, increment float64) {
+		for degrees := from; degrees <= to+increment/2; degrees += increment {
+			if s := score(degrees); s > bestScore {
+				best, bestScore = degrees, s
+			}
+		}
+	}
+	search(-maxSkewDegrees, maxSkewDegrees, 0.5)
+	search(best-0.5, best+0.5, 0.05)
+	return best
+}
+
+// rotateImage rotates img by degrees about its centre, keeping its size and filling the corners with white
+func rotateImage(img *image.RGBA, degrees float64) *image.RGBA {
+	bounds := img.Bounds()
+	rotated := image.NewRGBA(bounds)
+	draw.Draw(rotated, bounds, image.White, image.Point{}, draw.Src)
+
+	sin, cos := math.Sincos(degrees * math.Pi / 180)
+	centreX, centreY := float64(bounds.Dx())/2, float64(bounds.Dy())/2
+	sourceToDest := f64.Aff3{
+		cos, -sin, centreX - cos*centreX + sin*centreY,
+		sin, cos, centreY - sin*centreX - cos*centreY,
+	}
+	draw.BiLinear.Transform(rotated, sourceToDest, img, bounds, draw.Src, nil)
+	return rotated
+}
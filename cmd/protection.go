@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// ProtectionConfig configures optional PDF encryption and permissions.
+// Passwords are never read from config.yaml itself - only from environment variables or files.
+type ProtectionConfig struct {
+	UserPasswordEnv   string   `yaml:"userPasswordEnv,omitempty"`   // Environment variable holding the password needed to open the PDF
+	UserPasswordFile  string   `yaml:"userPasswordFile,omitempty"`  // File holding the password needed to open the PDF
+	OwnerPasswordEnv  string   `yaml:"ownerPasswordEnv,omitempty"`  // Environment variable holding the password granting full access
+	OwnerPasswordFile string   `yaml:"ownerPasswordFile,omitempty"` // File holding the password granting full access
+	Deny              []string `yaml:"deny,omitempty"`              // Restricted actions: print, modify, copy, annotate
+}
+
+// pdfProtection holds the resolved passwords and permission flags
+type pdfProtection struct {
+	actionFlag    byte
+	userPassword  string
+	ownerPassword string
+}
+
+// protectionActions maps the names accepted in 'deny' to gofpdf permission flags
+var protectionActions = map[string]byte{
+	"print":    gofpdf.CnProtectPrint,
+	"modify":   gofpdf.CnProtectModify,
+	"copy":     gofpdf.CnProtectCopy,
+	"annotate": gofpdf.CnProtectAnnotForms,
+}
+
+// resolveProtection reads passwords from the environment or files referenced by the config.
+// It returns nil if protection is not configured.
+func resolveProtection(config *Config, configDir string) (*pdfProtection, error) {
+	settings := config.Protection
+	if settings == nil {
+		return nil, nil
+	}
+
+	userPassword, err := readSecret(settings.UserPasswordEnv, settings.UserPasswordFile, configDir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading user password: %w", err)
+	}
+	ownerPassword, err := readSecret(settings.OwnerPasswordEnv, settings.OwnerPasswordFile, configDir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading owner password: %w", err)
+	}
+
+	// Start with every action allowed and remove the denied ones
+	var actionFlag byte
+	for _, flag := range protectionActions {
+		actionFlag |= flag
+	}
+	for _, action := range settings.Deny {
+		flag, ok := protectionActions[strings.ToLower(strings.TrimSpace(action))]
+		if !ok {
+			return nil, fmt.Errorf("unknown protection action '%s' (expected print, modify, copy or annotate)", action)
+		}
+		actionFlag &^= flag
+	}
+
+	return &pdfProtection{
+		actionFlag:    actionFlag,
+		userPassword:  userPassword,
+		ownerPassword: ownerPassword,
+	}, nil
+}
+
+// readSecret returns the value of envName if set, otherwise the trimmed contents of fileName
+// (relative to configDir). An empty string is returned if neither is configured.
+func readSecret(envName string, fileName string, configDir string) (string, error) {
+	if envName != "" && fileName != "" {
+		return "", fmt.Errorf("specify either an environment variable or a file, not both")
+	}
+
+	if envName != "" {
+		value, ok := os.LookupEnv(envName)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", envName)
+		}
+		return value, nil
+	}
+
+	if fileName != "" {
+		if !filepath.IsAbs(fileName) {
+			fileName = filepath.Join(configDir, fileName)
+		}
+		data, err := os.ReadFile(fileName)
+		if err != nil {
+			return "", fmt.Errorf("failed to read password file: %w", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+
+	return "", nil
+}
+
+// applyPDFProtection encrypts the document if protection is configured
+func applyPDFProtection(pdf *gofpdf.Fpdf, protection *pdfProtection) {
+	if protection == nil {
+		return
+	}
+	pdf.SetProtection(protection.actionFlag, protection.userPassword, protection.ownerPassword)
+}
@@ -22,9 +22,13 @@ func Execute() error {
 }
 
 func init() {
+	rootCmd.AddCommand(cacheCmd)
+	rootCmd.AddCommand(devCmd)
 	rootCmd.AddCommand(generateCmd)
 	rootCmd.AddCommand(generateSchemaCmd)
+	rootCmd.AddCommand(serveCmd)
 	rootCmd.AddCommand(updateCmd)
 	rootCmd.AddCommand(validateConfigCmd)
+	rootCmd.AddCommand(validateGigsCmd)
 	rootCmd.AddCommand(versionCmd)
 }
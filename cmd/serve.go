@@ -0,0 +1,377 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var serveAddr string
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve a live preview of the PDFs that refreshes when they are regenerated",
+	Long: `Generate the PDFs, watch the config, gig and image files like generate --watch, and serve
+a web page listing the PDFs with a built-in viewer. Open pages refresh automatically whenever
+PDFs are regenerated, and show any errors from the latest generation.`,
+	Run: runServe,
+}
+
+func init() {
+	addGenerateFlags(serveCmd)
+	serveCmd.Flags().StringVar(&serveAddr, "addr", "localhost:8080", "Address to listen on (use :8080 to allow other devices on the network)")
+}
+
+// previewServer serves the preview page and tells open pages when PDFs have been regenerated
+type previewServer struct {
+	mu          sync.Mutex
+	generating  bool
+	generatedAt time.Time
+	outputDir   string
+	errors      []string                   // Log messages from the latest generation
+	capturing   []string                   // Log messages from the generation in progress
+	subscribers map[chan struct{}]struct{} // One per open events stream
+}
+
+// previewStatus is sent to the page as JSON
+type previewStatus struct {
+	Generating  bool     `json:"generating"`
+	GeneratedAt string   `json:"generatedAt"`
+	PDFs        []string `json:"pdfs"` // Paths relative to the output folder, with forward slashes
+	Errors      []string `json:"errors"`
+}
+
+// logTimestamp matches the date and time log.Printf adds to each message
+var logTimestamp = regexp.MustCompile(`^\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2} `)
+
+func newPreviewServer() *previewServer {
+	return &previewServer{subscribers: make(map[chan struct{}]struct{})}
+}
+
+// Write receives log output, so that errors and warnings from generation can be shown on the page
+func (s *previewServer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		line = logTimestamp.ReplaceAllString(line, "")
+		if line == "" || strings.HasPrefix(line, "[DEBUG]") {
+			continue
+		}
+		s.capturing = append(s.capturing, line)
+	}
+	return len(p), nil
+}
+
+// start is called before each generation
+func (s *previewServer) start() {
+	s.mu.Lock()
+	s.generating = true
+	s.capturing = nil
+	s.mu.Unlock()
+	s.notify()
+}
+
+// finish is called after each generation
+func (s *previewServer) finish() {
+	outputDir := ""
+	if config, err := loadConfig(configFile); err == nil {
+		outputDir = resolveOutputDir(config, filepath.Dir(configFile))
+	}
+
+	s.mu.Lock()
+	s.generating = false
+	s.generatedAt = time.Now()
+	s.errors = s.capturing
+	s.capturing = nil
+	if outputDir != "" {
+		s.outputDir = outputDir
+	}
+	s.mu.Unlock()
+	s.notify()
+}
+
+// notify wakes every events stream. Notifications are coalesced, as each stream sends the
+// current status rather than the one at the time of the notification.
+func (s *previewServer) notify() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for subscriber := range s.subscribers {
+		select {
+		case subscriber <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (s *previewServer) status() previewStatus {
+	s.mu.Lock()
+	status := previewStatus{
+		Generating: s.generating,
+		Errors:     append([]string{}, s.errors...),
+		PDFs:       []string{},
+	}
+	if !s.generatedAt.IsZero() {
+		status.GeneratedAt = s.generatedAt.Format(time.RFC3339Nano)
+	}
+	outputDir := s.outputDir
+	s.mu.Unlock()
+
+	if outputDir != "" {
+		_ = filepath.WalkDir(outputDir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() || !strings.EqualFold(filepath.Ext(path), ".pdf") {
+				return nil
+			}
+			if rel, err := filepath.Rel(outputDir, path); err == nil {
+				status.PDFs = append(status.PDFs, filepath.ToSlash(rel))
+			}
+			return nil
+		})
+		sort.Strings(status.PDFs)
+	}
+	return status
+}
+
+func (s *previewServer) handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = io.WriteString(w, previewPage)
+	})
+
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(s.status())
+	})
+
+	mux.HandleFunc("/events", s.serveEvents)
+
+	// PDFs are served from the current output folder, which changes if the config does
+	mux.HandleFunc("/pdf/", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		outputDir := s.outputDir
+		s.mu.Unlock()
+		if outputDir == "" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		http.StripPrefix("/pdf/", http.FileServer(http.Dir(outputDir))).ServeHTTP(w, r)
+	})
+
+	return mux
+}
+
+// serveEvents streams a "status" Server-Sent Event whenever generation starts or finishes
+func (s *previewServer) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	notifications := make(chan struct{}, 1)
+	s.mu.Lock()
+	s.subscribers[notifications] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.subscribers, notifications)
+		s.mu.Unlock()
+	}()
+
+	// Comments keep the connection open through proxies and let us notice closed pages
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-notifications:
+			data, err := json.Marshal(s.status())
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "event: status\ndata: %s\n\n", data); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func runServe(cmd *cobra.Command, args []string) {
+	readSpacingFlag(cmd)
+
+	server := newPreviewServer()
+
+	// Listen before generating so that an address already in use is reported straight away
+	listener, err := net.Listen("tcp", serveAddr)
+	if err != nil {
+		log.Fatalf("Error starting preview server: %v", err)
+	}
+	httpServer := &http.Server{
+		Handler:           server.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := httpServer.Serve(listener); err != nil {
+			log.Fatalf("Error running preview server: %v", err)
+		}
+	}()
+	fmt.Printf("Preview available at http://%s\n", previewURLHost(listener.Addr()))
+
+	// Log output still goes to the console, and is also kept to show on the page
+	log.SetOutput(io.MultiWriter(os.Stderr, server))
+
+	runWatch(watchOptions{onStart: server.start, onFinish: server.finish})
+}
+
+// previewURLHost returns a host:port for the preview URL, using localhost when listening on all interfaces
+func previewURLHost(addr net.Addr) string {
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// previewPage lists the PDFs with a viewer for the selected one. It subscribes to /events
+// and reloads the list, errors and viewer whenever PDFs are regenerated.
+const previewPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Gigsheets preview</title>
+<style>
+  body { margin: 0; font-family: sans-serif; display: flex; height: 100vh; }
+  nav { width: 280px; overflow-y: auto; border-right: 1px solid #ccc; background: #f7f7f7; }
+  nav h1 { font-size: 1.1em; margin: 12px; }
+  #state { margin: 0 12px 12px; font-size: 0.85em; color: #555; }
+  #pdfs { list-style: none; margin: 0; padding: 0; }
+  #pdfs a { display: block; padding: 6px 12px; color: #222; text-decoration: none; word-break: break-all; }
+  #pdfs a:hover { background: #e6e6e6; }
+  #pdfs a.selected { background: #2e86de; color: #fff; }
+  main { flex: 1; display: flex; flex-direction: column; }
+  #errors { margin: 0; padding: 8px 12px 8px 28px; background: #fdecea; color: #a61b1b; max-height: 30vh; overflow-y: auto; font-size: 0.9em; }
+  #errors:empty { display: none; }
+  iframe { flex: 1; border: 0; width: 100%; }
+  #empty { margin: 24px; color: #555; }
+</style>
+</head>
+<body>
+<nav>
+  <h1>Gigsheets</h1>
+  <div id="state">Connecting...</div>
+  <ul id="pdfs"></ul>
+</nav>
+<main>
+  <ul id="errors"></ul>
+  <p id="empty" hidden>No PDFs have been generated yet.</p>
+  <iframe id="viewer" title="PDF viewer" hidden></iframe>
+</main>
+<script>
+  let version = "";
+
+  function selected() {
+    return decodeURIComponent(location.hash.slice(1));
+  }
+
+  function pdfURL(path) {
+    return "/pdf/" + path.split("/").map(encodeURIComponent).join("/") + "?v=" + encodeURIComponent(version);
+  }
+
+  function render(status) {
+    document.getElementById("state").textContent = status.generating
+      ? "Regenerating..."
+      : (status.generatedAt ? "Updated " + new Date(status.generatedAt).toLocaleTimeString() : "");
+
+    const list = document.getElementById("pdfs");
+    list.replaceChildren();
+    for (const path of status.pdfs) {
+      const link = document.createElement("a");
+      link.href = "#" + encodeURIComponent(path);
+      link.textContent = path.replace(/\.pdf$/i, "");
+      if (path === selected()) {
+        link.className = "selected";
+      }
+      const item = document.createElement("li");
+      item.appendChild(link);
+      list.appendChild(item);
+    }
+
+    const errors = document.getElementById("errors");
+    errors.replaceChildren();
+    for (const message of status.errors) {
+      const item = document.createElement("li");
+      item.textContent = message;
+      errors.appendChild(item);
+    }
+
+    if (!status.generating && status.generatedAt !== version) {
+      version = status.generatedAt;
+      show(status.pdfs);
+    }
+  }
+
+  function show(pdfs) {
+    const viewer = document.getElementById("viewer");
+    let path = selected();
+    if (pdfs && !pdfs.includes(path)) {
+      path = pdfs.length > 0 ? pdfs[0] : "";
+    }
+    document.getElementById("empty").hidden = path !== "";
+    viewer.hidden = path === "";
+    if (path !== "") {
+      viewer.src = pdfURL(path);
+    }
+  }
+
+  window.addEventListener("hashchange", () => {
+    for (const link of document.querySelectorAll("#pdfs a")) {
+      link.className = decodeURIComponent(link.hash.slice(1)) === selected() ? "selected" : "";
+    }
+    show(null);
+  });
+
+  const events = new EventSource("/events");
+  events.addEventListener("status", (event) => render(JSON.parse(event.data)));
+  events.onopen = () => fetch("/status").then((response) => response.json()).then(render);
+  events.onerror = () => {
+    document.getElementById("state").textContent = "Disconnected, retrying...";
+  };
+</script>
+</body>
+</html>
+`
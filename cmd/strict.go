@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"strings"
+)
+
+// strictExitCode is the exit status of generate --strict when a gig has unresolved songs or
+// colours, so that scripts can tell it apart from other failures (status 1)
+const strictExitCode = 2
+
+// strictError is returned by generation in strict mode when any gig has problems. No PDFs are
+// written; the error lists every problem found.
+type strictError struct {
+	diagnostics []gigDiagnostic
+}
+
+func (e *strictError) Error() string {
+	var report strings.Builder
+	fmt.Fprintf(&report, "strict mode: %d problem(s) found, no PDFs were written:", len(e.diagnostics))
+	for _, diagnostic := range e.diagnostics {
+		fmt.Fprintf(&report, "\n  %s", diagnostic)
+	}
+	return report.String()
+}
+
+// checkStrict validates every gig file (and the all-songs gig if includeAllSongs is set) as
+// validate-gigs does, returning a strictError if any song, image variant, image file or margin
+// colour does not resolve, an image cannot be decoded or a gig file cannot be loaded. It does
+// nothing without --strict.
+func checkStrict(config *Config, opts *renderOptions, gigFiles []string, includeAllSongs bool) error {
+	if !strictMode {
+		return nil
+	}
+
+	// Read just enough of each image to know it can be decoded, once per image
+	checked := make(map[string]error)
+	checkImage := func(imagePath string) error {
+		if err, done := checked[imagePath]; done {
+			return err
+		}
+		err := checkImageDecodes(imagePath)
+		checked[imagePath] = err
+		return err
+	}
+
+	songMap := buildSongMap(config)
+	var diagnostics []gigDiagnostic
+	for _, gigFile := range gigFiles {
+		diagnostics = append(diagnostics, validateGigFile(gigFile, songMap, opts.imageOverride, opts.imagesDir, checkImage)...)
+	}
+	if includeAllSongs {
+		diagnostics = append(diagnostics, validateGig(newAllSongsGig(config), nil, configFile, songMap, opts.imageOverride, opts.imagesDir, checkImage)...)
+	}
+
+	if len(diagnostics) > 0 {
+		return &strictError{diagnostics: diagnostics}
+	}
+	return nil
+}
+
+// checkImageDecodes returns an error if the image at imagePath is not in a format that can be decoded
+func checkImageDecodes(imagePath string) error {
+	file, err := os.Open(imagePath)
+	if err != nil {
+		return &songImageError{fmt.Sprintf("Image file cannot be read: %s (%v)", imagePath, err)}
+	}
+	defer func() { _ = file.Close() }()
+
+	if _, _, err := image.DecodeConfig(file); err != nil {
+		return &songImageError{fmt.Sprintf("Image file cannot be decoded: %s (%v)", imagePath, err)}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// OutputProfile is a named page layout for reading on a tablet, generated alongside the normal
+// PDFs as <gig>-<name>.pdf. Each song starts on a new page, scaled to the page width.
+type OutputProfile struct {
+	Aspect       string  `yaml:"aspect,omitempty"`       // Screen aspect ratio as width:height, e.g. "3:4" for iPads or "10:16" for most Android tablets (default: 3:4)
+	Width        float64 `yaml:"width,omitempty"`        // Page width in mm; the height follows from the aspect ratio (default: 210)
+	HalfPageTurn bool    `yaml:"halfPageTurn,omitempty"` // Each page repeats the bottom half of the previous one, for songs longer than a page
+}
+
+// tabletProfile is a resolved output profile
+type tabletProfile struct {
+	name         string
+	pageWidth    float64 // mm
+	pageHeight   float64 // mm
+	halfPageTurn bool
+}
+
+// resolveProfiles returns the options for rendering each output profile in the config, sorted by name
+func resolveProfiles(config *Config, opts *renderOptions) ([]*renderOptions, error) {
+	names := make([]string, 0, len(config.Profiles))
+	for name := range config.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var profiles []*renderOptions
+	for _, name := range names {
+		profile, err := resolveProfile(name, config.Profiles[name])
+		if err != nil {
+			return nil, fmt.Errorf("profile '%s': %w", name, err)
+		}
+
+		// Images are shown across the whole width of the profile's page
+		base := opts.imageSettings
+		base.displayWidthMM = profile.pageWidth - 2*pageMargin
+		base.fillWidth = true
+		songSettings, err := resolveSongImageSettings(config, base, false)
+		if err != nil {
+			return nil, fmt.Errorf("profile '%s': %w", name, err)
+		}
+
+		profileOpts := *opts
+		profileOpts.profile = profile
+		profileOpts.imageSettings = base
+		profileOpts.songSettings = songSettings
+		profiles = append(profiles, &profileOpts)
+	}
+	return profiles, nil
+}
+
+func resolveProfile(name string, config *OutputProfile) (*tabletProfile, error) {
+	if strings.TrimSpace(name) == "" || sanitizePathComponent(name) != name {
+		return nil, fmt.Errorf("name must not be empty or contain characters that are not allowed in file names")
+	}
+	// These would give the same file names as the dark and large-print copies of each PDF
+	for _, reserved := range []string{strings.TrimPrefix(darkTheme.suffix, "-"), strings.TrimPrefix(largePrintSuffix, "-")} {
+		if strings.EqualFold(name, reserved) {
+			return nil, fmt.Errorf("name '%s' is reserved for the %s copy of each PDF", name, reserved)
+		}
+	}
+	if config == nil {
+		config = &OutputProfile{}
+	}
+
+	profile := &tabletProfile{name: name, pageWidth: 210, halfPageTurn: config.HalfPageTurn}
+	if config.Width != 0 {
+		if config.Width < 50 {
+			return nil, fmt.Errorf("width must be at least 50mm")
+		}
+		profile.pageWidth = config.Width
+	}
+
+	aspect := config.Aspect
+	if strings.TrimSpace(aspect) == "" {
+		aspect = "3:4"
+	}
+	ratio, err := parseAspectRatio(aspect)
+	if err != nil {
+		return nil, err
+	}
+	profile.pageHeight = profile.pageWidth / ratio
+	return profile, nil
+}
+
+// parseAspectRatio parses a width:height ratio such as "3:4" into width divided by height
+func parseAspectRatio(value string) (float64, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) == 2 {
+		width, errWidth := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+		height, errHeight := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if errWidth == nil && errHeight == nil && width > 0 && height > 0 {
+			return width / height, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid aspect '%s' (expected width:height, e.g. 3:4)", value)
+}
+
+// newPDF creates an empty document with the page size of the options' profile, or A4 if none
+func (o *renderOptions) newPDF() *gofpdf.Fpdf {
+	if o.profile == nil {
+		return newGigPDF()
+	}
+	pdf := gofpdf.NewCustom(&gofpdf.InitType{
+		OrientationStr: "P",
+		UnitStr:        "mm",
+		Size:           gofpdf.SizeType{Wd: o.profile.pageWidth, Ht: o.profile.pageHeight},
+	})
+	pdf.SetAutoPageBreak(false, 0)
+	return pdf
+}
+
+// contentArea is the part of a page song images are drawn in, in mm
+type contentArea struct {
+	x, y, width, height float64
+}
+
+// renderSongPages draws a song image scaled to the width of area, starting on a new page and
+// continuing on as many pages as it needs. With half-page turns each page starts halfway down
+// the previous one, so the bottom half of one page is repeated at the top of the next. A song
+// only slightly taller than a page is shrunk to fit instead of spilling onto another page.
+// newPage is called before each page (first is true for the song's first page) and marginBand
+// after each, with the part of the area the image covers. It returns the number of pages used.
+func renderSongPages(pdf *gofpdf.Fpdf, imageName string, imageWidth, imageHeight float64, area contentArea, halfPageTurn bool, newPage func(first bool), marginBand func(y, height float64)) int {
+	width := area.width
+	height := imageHeight * area.width / imageWidth
+	if height > area.height && height <= area.height*1.25 {
+		width *= area.height / height
+		height = area.height
+	}
+
+	step := area.height
+	if halfPageTurn {
+		step = area.height / 2
+	}
+
+	pages := 0
+	for top := 0.0; ; top += step {
+		newPage(top == 0)
+		pages++
+
+		visible := math.Min(area.height, height-top)
+		pdf.ClipRect(area.x, area.y, area.width, visible, false)
+		pdf.ImageOptions(imageName, area.x, area.y-top, width, height, false, gofpdf.ImageOptions{}, 0, "")
+		pdf.ClipEnd()
+		marginBand(area.y, visible)
+
+		// Allow for rounding so that a sliver of a millimetre does not get a page of its own
+		if top+area.height >= height-0.01 {
+			return pages
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+const (
+	themeLight = "light"
+	themeDark  = "dark"
+)
+
+// pdfTheme holds the colours a PDF is drawn with
+type pdfTheme struct {
+	name         string
+	background   *rgbColor // Page colour; nil to leave pages white
+	text         rgbColor  // Footer text
+	line         rgbColor  // Group separators
+	invertImages bool      // Invert song images, so that black ink on white paper becomes light on dark
+	suffix       string    // Added to the output file name, before the extension
+}
+
+// lightTheme is the normal black on white
+var lightTheme = pdfTheme{
+	name: themeLight,
+}
+
+// darkTheme is for reading tablets on a dark stage. Group margin colours are kept as they are.
+var darkTheme = pdfTheme{
+	name:         themeDark,
+	background:   &rgbColor{0, 0, 0},
+	text:         rgbColor{200, 200, 200},
+	line:         rgbColor{160, 160, 160},
+	invertImages: true,
+	suffix:       "-dark",
+}
+
+// resolveThemes returns the themes each PDF is generated in. The normal light PDF is always
+// generated; --theme dark (or theme: dark in the config) adds a dark copy alongside it.
+func resolveThemes(config *Config) ([]pdfTheme, error) {
+	theme := config.Theme
+	if themeFlag != "" {
+		theme = themeFlag
+	}
+
+	switch strings.ToLower(strings.TrimSpace(theme)) {
+	case "", themeLight:
+		return []pdfTheme{lightTheme}, nil
+	case themeDark:
+		return []pdfTheme{lightTheme, darkTheme}, nil
+	default:
+		return nil, fmt.Errorf("theme must be light or dark, got '%s'", theme)
+	}
+}
+
+// withTheme returns a copy of the options for rendering in theme
+func (o *renderOptions) withTheme(theme pdfTheme) *renderOptions {
+	themed := *o
+	themed.theme = theme
+	return &themed
+}
+
+// applyTheme fills every page with the theme's background colour. It is drawn when each page
+// is started so that the song images and footer sit on top of it.
+func applyTheme(pdf *gofpdf.Fpdf, theme pdfTheme) {
+	if theme.background == nil {
+		return
+	}
+
+	pdf.SetHeaderFunc(func() {
+		pageWidth, pageHeight := pdf.GetPageSize()
+		pdf.SetFillColor(theme.background.r, theme.background.g, theme.background.b)
+		pdf.Rect(0, 0, pageWidth, pageHeight, "F")
+	})
+}
@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+	"gopkg.in/yaml.v3"
+)
+
+// Tour represents the structure of a tour YAML file used with generate --combine
+type Tour struct {
+	Name string   `yaml:"name,omitempty"` // Optional: defaults to the tour file name without its extension
+	Gigs []string `yaml:"gigs"`           // Gig files in running order, relative to the tour file
+}
+
+func loadTour(filename string) (*Tour, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tour file: %w", err)
+	}
+
+	var tour Tour
+	err = yaml.Unmarshal(data, &tour)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse tour YAML: %w", err)
+	}
+
+	if len(tour.Gigs) == 0 {
+		return nil, fmt.Errorf("tour file must list at least one gig under 'gigs'")
+	}
+
+	// Without a name the PDF title and messages would be empty, so use the file's name instead
+	if strings.TrimSpace(tour.Name) == "" {
+		base := filepath.Base(filename)
+		tour.Name = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+
+	return &tour, nil
+}
+
+// generateCombinedGigs renders every gig listed in the tour file into a single PDF
+// named after the tour file, with a bookmark for each gig and its sets
+func generateCombinedGigs() error {
+	// Load configuration
+	config, err := loadConfig(configFile)
+	if err != nil {
+		return fmt.Errorf("error loading config file: %w", err)
+	}
+
+	tour, err := loadTour(combineFile)
+	if err != nil {
+		return fmt.Errorf("error loading tour file: %w", err)
+	}
+
+	configDir := filepath.Dir(configFile)
+	tourDir := filepath.Dir(combineFile)
+	outputDir := resolveOutputDir(config, configDir)
+
+	opts, err := resolveRenderOptions(config, configDir)
+	if err != nil {
+		return err
+	}
+
+	variants, err := resolveOutputVariants(config, opts)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(outputDir, 0755)
+	if err != nil {
+		return fmt.Errorf("error creating output directory: %w", err)
+	}
+
+	tourBasename := filepath.Base(combineFile)
+	outputFile := filepath.Join(outputDir, strings.TrimSuffix(tourBasename, filepath.Ext(tourBasename))+".pdf")
+
+	var tourGigFiles []string
+	for _, gigPath := range tour.Gigs {
+		gigFile := gigPath
+		if !filepath.IsAbs(gigFile) {
+			gigFile = filepath.Join(tourDir, gigFile)
+		}
+		tourGigFiles = append(tourGigFiles, gigFile)
+	}
+
+	// With --strict, check every gig before anything is generated
+	err = checkStrict(config, opts, tourGigFiles, false)
+	if err != nil {
+		return err
+	}
+
+	// Load every gig first so that their images can be prepared in parallel
+	var renderedGigs []*Gig
+	var gigFiles []string
+	for _, gigFile := range tourGigFiles {
+		gig, err := loadGig(gigFile)
+		if err != nil {
+			log.Printf("Error loading gig file %s: %v", gigFile, err)
+			continue
+		}
+
+		renderedGigs = append(renderedGigs, gig)
+		gigFiles = append(gigFiles, gigFile)
+	}
+
+	if len(renderedGigs) == 0 {
+		return fmt.Errorf("none of the gigs in %s could be loaded", combineFile)
+	}
+
+	songMap := buildSongMap(config)
+	var requests []imageRequest
+	for _, variant := range variants {
+		for _, gig := range renderedGigs {
+			requests = append(requests, gigImageRequests(songMap, gig, variant.opts)...)
+		}
+	}
+	opts.images.prepareAll(requests, opts.jobs, opts.imageCache)
+
+	// Only the last variant mapping to a file is generated, as for gig PDFs
+	generatedFrom := make(map[string]int)
+	for i, variant := range variants {
+		variantFile := variant.outputPath(outputFile)
+		if previous, exists := generatedFrom[variantFile]; exists {
+			log.Print(variantClashWarning(variants[previous], variant, variantFile))
+		}
+		generatedFrom[variantFile] = i
+	}
+
+	for i, variant := range variants {
+		variantFile := variant.outputPath(outputFile)
+		if generatedFrom[variantFile] != i {
+			continue
+		}
+		err = writePDF(variantFile, variant.opts, directOutput(), func(opts *renderOptions, out *jobOutput) *gofpdf.Fpdf {
+			pdf := opts.newPDF()
+			applyPDFProtection(pdf, opts.protection)
+			applyTheme(pdf, opts.theme)
+			applyWatermark(pdf, opts.watermark)
+			for i, gig := range renderedGigs {
+				renderGig(pdf, config, gig, gigFiles[i], opts, true, out)
+			}
+			applyPDFMetadata(pdf, tourMetadata(config, tour, renderedGigs))
+			return pdf
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Successfully generated combined PDF for '%s' (%d gigs): %s\n", tour.Name, len(renderedGigs), variantFile)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"image"
 	"log"
 	"os"
 	"path/filepath"
@@ -52,8 +53,24 @@ func runValidateConfig(cmd *cobra.Command, args []string) {
 	// Track validation results
 	var missingImages []string
 	var validImages []string
+	var sidewaysImages []string
 	configChanged := false
 
+	// Per-song rotation, so that images which still look sideways can be flagged
+	baseSettings, err := resolveImageSettings(config, 0)
+	if err != nil {
+		log.Fatalf("Invalid image settings: %v", err)
+	}
+	songSettings, err := resolveSongImageSettings(config, baseSettings, false)
+	if err != nil {
+		log.Fatalf("Invalid image settings: %v", err)
+	}
+	checkSideways := func(description string, nickname string, variant string, imagePath string) {
+		if warning := sidewaysWarning(imagePath, songSettings[nickname][variant].orient); warning != "" {
+			sidewaysImages = append(sidewaysImages, fmt.Sprintf("%s: %s", description, warning))
+		}
+	}
+
 	// Validate existing images in config
 	for _, song := range config.Songs {
 		// Handle backward compatibility - single image
@@ -63,6 +80,7 @@ func runValidateConfig(cmd *cobra.Command, args []string) {
 				missingImages = append(missingImages, fmt.Sprintf("Song '%s': %s", song.Nickname, song.Image))
 			} else {
 				validImages = append(validImages, fmt.Sprintf("Song '%s': %s", song.Nickname, song.Image))
+				checkSideways(fmt.Sprintf("Song '%s'", song.Nickname), song.Nickname, "default", imagePath)
 			}
 		}
 
@@ -74,6 +92,7 @@ func runValidateConfig(cmd *cobra.Command, args []string) {
 					missingImages = append(missingImages, fmt.Sprintf("Song '%s' variant '%s': %s", song.Nickname, variant, imageName))
 				} else {
 					validImages = append(validImages, fmt.Sprintf("Song '%s' variant '%s': %s", song.Nickname, variant, imageName))
+					checkSideways(fmt.Sprintf("Song '%s' variant '%s'", song.Nickname, variant), song.Nickname, variant, imagePath)
 				}
 			}
 		}
@@ -97,6 +116,14 @@ func runValidateConfig(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	if len(sidewaysImages) > 0 {
+		fmt.Printf("\nPossibly sideways images (%d):\n", len(sidewaysImages))
+		for _, img := range sidewaysImages {
+			fmt.Printf("  ! %s\n", img)
+		}
+		fmt.Printf("Set rotate: 90 or rotate: 270 on the song (or its variant) if these are rotated.\n")
+	}
+
 	// Handle --add-missing flag
 	if addMissing {
 		fmt.Printf("\nScanning for images to add...\n")
@@ -269,6 +296,26 @@ func runValidateConfig(cmd *cobra.Command, args []string) {
 	}
 }
 
+// sidewaysWarning describes why the image at imagePath looks like a page turned on its side once
+// orient is applied, or returns "" if it does not (or cannot be read)
+func sidewaysWarning(imagePath string, orient orientSettings) string {
+	file, err := os.Open(imagePath)
+	if err != nil {
+		return ""
+	}
+	defer func() { _ = file.Close() }()
+
+	imageConfig, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return ""
+	}
+	width, height := orient.size(imageConfig.Width, imageConfig.Height)
+	if !looksSideways(width, height) {
+		return ""
+	}
+	return fmt.Sprintf("%s is %dx%d, the shape of a sideways page", filepath.Base(imagePath), width, height)
+}
+
 // writeConfig writes the config struct back to a YAML file
 func writeConfig(config *Config, filename string) error {
 	data, err := yaml.Marshal(config)
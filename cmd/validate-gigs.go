@@ -0,0 +1,265 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	validateGigsConfigFile    string
+	validateGigsImageOverride string
+)
+
+var validateGigsCmd = &cobra.Command{
+	Use:   "validate-gigs",
+	Short: "Validate that every song in the gig files can be found",
+	Long: `Validate every gig file in the gigs folder against the config file, reporting unknown
+songs, missing image variants, missing image files and invalid margin colours as
+file:line:column diagnostics. Exits with status 1 if any problems are found.`,
+	Run: runValidateGigs,
+}
+
+func init() {
+	validateGigsCmd.Flags().StringVarP(&validateGigsConfigFile, "config", "c", "config.yaml", "Path to config YAML file")
+	validateGigsCmd.Flags().StringVarP(&validateGigsImageOverride, "image-override", "i", "", "Image name to check for all songs if it exists, as with generate --image-override")
+}
+
+func runValidateGigs(cmd *cobra.Command, args []string) {
+	config, err := loadConfig(validateGigsConfigFile)
+	if err != nil {
+		log.Fatalf("Error loading config file: %v", err)
+	}
+
+	configDir := filepath.Dir(validateGigsConfigFile)
+	gigsDir := filepath.Join(configDir, config.GigsFolder)
+	imagesDir := filepath.Join(configDir, config.ImageFolder)
+
+	gigFiles, err := findGigFiles(gigsDir)
+	if err != nil {
+		log.Fatalf("Error finding gig files: %v", err)
+	}
+	if len(gigFiles) == 0 {
+		fmt.Printf("No gig files found in %s\n", gigsDir)
+		return
+	}
+
+	songMap := buildSongMap(config)
+	var diagnostics []gigDiagnostic
+	for _, gigFile := range gigFiles {
+		diagnostics = append(diagnostics, validateGigFile(gigFile, songMap, validateGigsImageOverride, imagesDir, nil)...)
+	}
+
+	for _, diagnostic := range diagnostics {
+		fmt.Println(diagnostic)
+	}
+	if len(diagnostics) > 0 {
+		fmt.Printf("\nValidation failed: %d problem(s) in %d gig file(s)\n", len(diagnostics), len(gigFiles))
+		os.Exit(1)
+	}
+	fmt.Printf("✓ All songs in %d gig file(s) resolve\n", len(gigFiles))
+}
+
+// gigDiagnostic is a problem found in a gig file. line and column are 1-based, or 0 if not
+// known; yaml.v3's syntax errors only give a line.
+type gigDiagnostic struct {
+	file    string
+	line    int
+	column  int
+	message string
+}
+
+func (d gigDiagnostic) String() string {
+	if d.line == 0 {
+		return fmt.Sprintf("%s: %s", d.file, d.message)
+	}
+	if d.column == 0 {
+		return fmt.Sprintf("%s:%d: %s", d.file, d.line, d.message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", d.file, d.line, d.column, d.message)
+}
+
+// yamlErrorLine matches the line number yaml.v3 puts in syntax and type errors
+var yamlErrorLine = regexp.MustCompile(`line (\d+): (.*)`)
+
+// validateGigFile loads a gig file and checks that every song in it resolves to an image
+func validateGigFile(gigFile string, songMap map[string]map[string]string, imageOverride string, imagesDir string, checkImage func(imagePath string) error) []gigDiagnostic {
+	gig, err := loadGig(gigFile)
+	if err != nil {
+		return []gigDiagnostic{gigLoadDiagnostic(gigFile, err)}
+	}
+
+	// The gig has already been parsed, so this only fails if the file changed in between
+	var root yaml.Node
+	if data, err := os.ReadFile(gigFile); err == nil {
+		_ = yaml.Unmarshal(data, &root)
+	}
+	return validateGig(gig, &root, gigFile, songMap, imageOverride, imagesDir, checkImage)
+}
+
+// gigLoadDiagnostic turns an error from loadGig into a diagnostic, finding its position where
+// possible. yaml.v3 reports the line of syntax errors, but not of errors from SetSongItem's
+// UnmarshalYAML, so the items are decoded one by one to find the one at fault.
+func gigLoadDiagnostic(gigFile string, err error) gigDiagnostic {
+	diagnostic := gigDiagnostic{file: gigFile, message: err.Error()}
+
+	var typeError *yaml.TypeError
+	if errors.As(err, &typeError) && len(typeError.Errors) > 0 {
+		diagnostic.message = typeError.Errors[0]
+	}
+	if match := yamlErrorLine.FindStringSubmatch(diagnostic.message); match != nil {
+		diagnostic.line, _ = strconv.Atoi(match[1])
+		diagnostic.message = match[2]
+		return diagnostic
+	}
+
+	var root yaml.Node
+	data, readErr := os.ReadFile(gigFile)
+	if readErr != nil || yaml.Unmarshal(data, &root) != nil {
+		return diagnostic
+	}
+	for _, setNode := range sequenceItems(mappingValue(&root, "sets")) {
+		for _, itemNode := range sequenceItems(mappingValue(setNode, "songs")) {
+			var item SetSongItem
+			if itemErr := itemNode.Decode(&item); itemErr != nil {
+				diagnostic.line, diagnostic.column = itemNode.Line, itemNode.Column
+				diagnostic.message = itemErr.Error()
+				return diagnostic
+			}
+		}
+	}
+	return diagnostic
+}
+
+// validateGig checks that every song in a gig resolves to an image, exactly as renderGig
+// resolves them, and that group margin colours are valid. root is the parsed gig file, used
+// for the position of each problem; without it (e.g. for the all-songs gig) none are given.
+// If checkImage is not nil, it is also called with the path of each image that resolves.
+func validateGig(gig *Gig, root *yaml.Node, gigFile string, songMap map[string]map[string]string, imageOverride string, imagesDir string, checkImage func(imagePath string) error) []gigDiagnostic {
+	var diagnostics []gigDiagnostic
+	report := func(node *yaml.Node, message string) {
+		diagnostic := gigDiagnostic{file: gigFile, message: message}
+		if node != nil {
+			diagnostic.line, diagnostic.column = node.Line, node.Column
+		}
+		diagnostics = append(diagnostics, diagnostic)
+	}
+
+	setNodes := sequenceItems(mappingValue(root, "sets"))
+	for i, set := range gig.Sets {
+		var itemNodes []*yaml.Node
+		if i < len(setNodes) {
+			itemNodes = sequenceItems(mappingValue(setNodes[i], "songs"))
+		}
+
+		for j, item := range set.Songs {
+			var itemNode *yaml.Node
+			if j < len(itemNodes) {
+				itemNode = itemNodes[j]
+			}
+
+			songs := []string{item.Song}
+			songNodes := []*yaml.Node{songValueNode(itemNode)}
+			if item.Group != nil {
+				songs = item.Group.Songs
+				songNodes = groupSongNodes(itemNode)
+
+				if strings.TrimSpace(item.Group.MarginColour) != "" {
+					if _, err := parseHexColor(item.Group.MarginColour); err != nil {
+						report(orNode(mappingValue(mappingValue(itemNode, "group"), "marginColour"), itemNode),
+							fmt.Sprintf("Invalid marginColour '%s' for group in set '%s': %v", item.Group.MarginColour, set.Name, err))
+					}
+				}
+			}
+
+			for k, songName := range songs {
+				if strings.TrimSpace(songName) == "" {
+					continue
+				}
+				var songNode *yaml.Node
+				if k < len(songNodes) {
+					songNode = songNodes[k]
+				}
+				imagePath, err := resolveSongImage(songMap, songName, imageOverride, imagesDir)
+				if err == nil && checkImage != nil {
+					err = checkImage(imagePath)
+				}
+				if err != nil {
+					report(orNode(songNode, itemNode), fmt.Sprintf("%v (set '%s')", err, set.Name))
+				}
+			}
+		}
+	}
+	return diagnostics
+}
+
+// resolveNode follows documents and aliases to the node holding the value
+func resolveNode(node *yaml.Node) *yaml.Node {
+	for node != nil {
+		switch {
+		case node.Kind == yaml.DocumentNode && len(node.Content) > 0:
+			node = node.Content[0]
+		case node.Kind == yaml.AliasNode && node.Alias != nil:
+			node = node.Alias
+		default:
+			return node
+		}
+	}
+	return nil
+}
+
+// mappingValue returns the value of key in a mapping node, or nil if there is none
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	node = resolveNode(node)
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i < len(node.Content)-1; i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// sequenceItems returns the items of a sequence node, or nil if it is not a sequence
+func sequenceItems(node *yaml.Node) []*yaml.Node {
+	node = resolveNode(node)
+	if node == nil || node.Kind != yaml.SequenceNode {
+		return nil
+	}
+	return node.Content
+}
+
+// songValueNode returns the node naming the song of a single-song item ("song" or song: "song")
+func songValueNode(itemNode *yaml.Node) *yaml.Node {
+	if song := mappingValue(itemNode, "song"); song != nil {
+		return song
+	}
+	return itemNode
+}
+
+// groupSongNodes returns the nodes of a group's songs, in either group form
+func groupSongNodes(itemNode *yaml.Node) []*yaml.Node {
+	group := mappingValue(itemNode, "group")
+	if songs := sequenceItems(group); songs != nil {
+		return songs
+	}
+	return sequenceItems(mappingValue(group, "songs"))
+}
+
+// orNode returns node, or fallback if node is nil
+func orNode(node *yaml.Node, fallback *yaml.Node) *yaml.Node {
+	if node != nil {
+		return node
+	}
+	return fallback
+}
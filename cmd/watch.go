@@ -0,0 +1,378 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDependencies records which outputs depend on which files, so that watch mode
+// only regenerates the PDFs affected by a change. Every path is absolute.
+type watchDependencies struct {
+	configFile string
+	tourFile   string              // Empty unless combining gigs
+	gigsDir    string              // Gigs folder; new gig files here are generated
+	outputDir  string              // Changes here are our own output and are ignored
+	gigFiles   map[string]bool     // Gig files that produce a PDF (or are part of the combined PDF)
+	imageDirs  map[string]bool     // Folders containing the images used by any output
+	images     map[string][]string // Image path to the gig files using it (the config file for _all.pdf)
+	missing    []string            // Gig files with songs whose image could not be found, which a new image may fix
+}
+
+// resolveWatchDependencies loads the config and gigs and maps each image to the outputs
+// that use it. Gigs that fail to load are skipped; they are reported when generating.
+func resolveWatchDependencies() (*watchDependencies, error) {
+	config, err := loadConfig(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("error loading config file: %w", err)
+	}
+
+	configDir := filepath.Dir(configFile)
+	imagesDir := filepath.Join(configDir, config.ImageFolder)
+	deps := &watchDependencies{
+		configFile: absolutePath(configFile),
+		gigsDir:    absolutePath(filepath.Join(configDir, config.GigsFolder)),
+		outputDir:  absolutePath(resolveOutputDir(config, configDir)),
+		gigFiles:   make(map[string]bool),
+		// The images folder is always watched so that newly added images are noticed
+		imageDirs: map[string]bool{absolutePath(imagesDir): true},
+		images:    make(map[string][]string),
+	}
+
+	var gigFiles []string
+	if combineFile != "" {
+		deps.tourFile = absolutePath(combineFile)
+		tour, err := loadTour(combineFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading tour file: %w", err)
+		}
+		for _, gigPath := range tour.Gigs {
+			if !filepath.IsAbs(gigPath) {
+				gigPath = filepath.Join(filepath.Dir(combineFile), gigPath)
+			}
+			gigFiles = append(gigFiles, gigPath)
+		}
+	} else {
+		gigFiles, err = findGigFiles(deps.gigsDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Gigs that produce outputs, keyed by the file used to select them for regeneration
+	gigs := make(map[string]*Gig)
+	for _, gigFile := range gigFiles {
+		deps.gigFiles[absolutePath(gigFile)] = true
+		if gig, err := loadGig(gigFile); err == nil {
+			gigs[absolutePath(gigFile)] = gig
+		}
+	}
+	if allSongs && combineFile == "" {
+		gigs[deps.configFile] = newAllSongsGig(config)
+	}
+
+	songMap := buildSongMap(config)
+	for gigFile, gig := range gigs {
+		for _, songRef := range gigSongRefs(gig) {
+			imagePath, err := resolveSongImage(songMap, songRef, imageOverride, imagesDir)
+			if err != nil {
+				deps.missing = appendUnique(deps.missing, gigFile)
+				continue
+			}
+			imagePath = absolutePath(imagePath)
+			deps.imageDirs[filepath.Dir(imagePath)] = true
+			deps.images[imagePath] = appendUnique(deps.images[imagePath], gigFile)
+		}
+	}
+	sort.Strings(deps.missing)
+
+	return deps, nil
+}
+
+// watchDirs lists every folder to watch. Folders are watched rather than files so that
+// editors which save by writing a new file and renaming it over the old one are noticed.
+func (d *watchDependencies) watchDirs() []string {
+	dirs := map[string]bool{
+		filepath.Dir(d.configFile): true,
+		d.gigsDir:                  true,
+	}
+	if d.tourFile != "" {
+		dirs[filepath.Dir(d.tourFile)] = true
+	}
+	for gigFile := range d.gigFiles {
+		dirs[filepath.Dir(gigFile)] = true
+	}
+	for dir := range d.imageDirs {
+		dirs[dir] = true
+	}
+
+	var sorted []string
+	for dir := range dirs {
+		sorted = append(sorted, dir)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// affectedGigs returns the gig files whose PDFs depend on the changed files, and whether
+// everything must be regenerated (the config or tour file changed)
+func (d *watchDependencies) affectedGigs(changed []string) (map[string]bool, bool) {
+	gigFiles := make(map[string]bool)
+	for _, path := range changed {
+		switch {
+		case path == d.configFile, d.tourFile != "" && path == d.tourFile:
+			return nil, true
+		case path == d.outputDir, strings.HasPrefix(path, d.outputDir+string(filepath.Separator)):
+			// Our own PDFs and build manifest
+		case isGigFileName(path) && (d.gigFiles[path] || filepath.Dir(path) == d.gigsDir):
+			if d.tourFile != "" {
+				// The combined PDF is one output, so any gig change regenerates it
+				return nil, true
+			}
+			gigFiles[path] = true
+		case len(d.images[path]) > 0:
+			for _, gigFile := range d.images[path] {
+				gigFiles[gigFile] = true
+			}
+		case d.imageDirs[filepath.Dir(path)]:
+			// A new image may be one a gig was missing
+			for _, gigFile := range d.missing {
+				gigFiles[gigFile] = true
+			}
+		}
+	}
+	return gigFiles, false
+}
+
+// syncWatches makes watcher watch exactly dirs, given the folders in watched (which is updated).
+// Folders that do not exist are reported and tried again on the next sync.
+func syncWatches(watcher *fsnotify.Watcher, watched map[string]bool, dirs []string) {
+	wanted := make(map[string]bool)
+	for _, dir := range dirs {
+		wanted[dir] = true
+	}
+
+	for dir := range watched {
+		if wanted[dir] {
+			continue
+		}
+		// Removing fails if the folder was deleted, in which case it is no longer watched anyway
+		_ = watcher.Remove(dir)
+		delete(watched, dir)
+	}
+
+	for _, dir := range dirs {
+		if watched[dir] {
+			continue
+		}
+		if _, err := os.Stat(dir); err != nil {
+			log.Printf("Warning: not watching %s: %v", dir, err)
+			continue
+		}
+		if err := watcher.Add(dir); err != nil {
+			log.Printf("Warning: not watching %s: %v", dir, err)
+			continue
+		}
+		watched[dir] = true
+	}
+}
+
+func isGigFileName(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, existing := range values {
+		if existing == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+// watchOptions selects what the watch pipeline keeps up to date besides the PDFs
+type watchOptions struct {
+	schemaFile string // When set, the gig JSON Schema is written here whenever the config changes
+	onStart    func() // Optional, called before each generation
+	onFinish   func() // Optional, called after each generation
+}
+
+// runWatch generates everything once, then watches the config, gig and image files and
+// regenerates the affected outputs whenever they change. It is shared by generate --watch,
+// dev and serve so that all of them use one watcher and debounce.
+func runWatch(opts watchOptions) {
+	if opts.onStart != nil {
+		opts.onStart()
+	}
+
+	// The schema is quick to write and makes editor autocomplete available straight away
+	if opts.schemaFile != "" {
+		fmt.Println("Initial schema generation...")
+		if err := writeGigSchema(configFile, opts.schemaFile); err != nil {
+			log.Printf("Error generating schema: %v", err)
+		}
+	}
+
+	// Initial generation
+	fmt.Println("Initial PDF generation...")
+	err := generateOutputs()
+	if err != nil {
+		log.Printf("Error during initial generation: %v", err)
+	}
+	if opts.onFinish != nil {
+		opts.onFinish()
+	}
+
+	deps, err := resolveWatchDependencies()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	// Set up file watcher
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Fatalf("Error creating watcher: %v", err)
+	}
+	defer func() {
+		if err := watcher.Close(); err != nil {
+			log.Printf("Error closing watcher: %v", err)
+		}
+	}()
+
+	watched := make(map[string]bool)
+	syncWatches(watcher, watched, deps.watchDirs())
+	if !watched[filepath.Dir(deps.configFile)] {
+		log.Fatalf("Error watching config folder %s", filepath.Dir(deps.configFile))
+	}
+
+	fmt.Printf("\nWatching for changes...\n")
+	fmt.Printf("  Config:  %s\n", configFile)
+	fmt.Printf("  Gigs:    %s\n", deps.gigsDir)
+	if combineFile != "" {
+		fmt.Printf("  Tour:    %s\n", combineFile)
+	}
+	if opts.schemaFile != "" {
+		fmt.Printf("  Schema:  %s\n", opts.schemaFile)
+	}
+	fmt.Printf("  Folders: %s\n", strings.Join(deps.watchDirs(), ", "))
+	fmt.Println("\nPress Ctrl+C to stop")
+
+	// Changes are collected until no more arrive for the debounce duration, then
+	// the affected PDFs are regenerated together. generateMu stops regenerations overlapping.
+	var pendingMu, generateMu sync.Mutex
+	pending := make(map[string]bool)
+	var debounceTimer *time.Timer
+	debounceDuration := 500 * time.Millisecond
+
+	regenerate := func() {
+		generateMu.Lock()
+		defer generateMu.Unlock()
+
+		pendingMu.Lock()
+		var changed []string
+		for path := range pending {
+			// Writing the schema must not trigger another regeneration
+			if opts.schemaFile != "" && path == absolutePath(opts.schemaFile) {
+				continue
+			}
+			changed = append(changed, path)
+		}
+		pending = make(map[string]bool)
+		pendingMu.Unlock()
+		if len(changed) == 0 {
+			return
+		}
+		sort.Strings(changed)
+
+		gigFiles, all := deps.affectedGigs(changed)
+		if !all && len(gigFiles) == 0 {
+			// e.g. an image no output uses
+			return
+		}
+
+		var names []string
+		for _, path := range changed {
+			names = append(names, filepath.Base(path))
+		}
+		fmt.Printf("\n[%s] Change detected in: %s\n", time.Now().Format("15:04:05"), strings.Join(names, ", "))
+
+		if opts.onStart != nil {
+			opts.onStart()
+		}
+		var err error
+		if all {
+			if opts.schemaFile != "" {
+				fmt.Println("Regenerating schema...")
+				if err := writeGigSchema(configFile, opts.schemaFile); err != nil {
+					log.Printf("Error generating schema: %v", err)
+				}
+			}
+			fmt.Println("Regenerating PDFs...")
+			err = generateOutputs()
+		} else {
+			fmt.Printf("Regenerating %d affected PDF(s)...\n", len(gigFiles))
+			err = generateSelectedOutputs(gigFiles)
+		}
+		if err != nil {
+			log.Printf("Error generating PDFs: %v", err)
+		} else {
+			fmt.Println("✓ PDFs regenerated successfully")
+		}
+		if opts.onFinish != nil {
+			opts.onFinish()
+		}
+
+		// The config may have moved the gigs or images folders, and gigs may use different images.
+		// If the config cannot be loaded, keep watching the previous folders until it is fixed.
+		updated, err := resolveWatchDependencies()
+		if err != nil {
+			log.Printf("Error updating watched files: %v", err)
+			return
+		}
+		previousDirs := strings.Join(deps.watchDirs(), ", ")
+		deps = updated
+		syncWatches(watcher, watched, deps.watchDirs())
+		if dirs := strings.Join(deps.watchDirs(), ", "); dirs != previousDirs {
+			fmt.Printf("Now watching: %s\n", dirs)
+		}
+	}
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+
+			// Renames and removes matter too: atomic saves rename a new file over the old one,
+			// and a removed image or gig should be reported rather than silently ignored
+			if event.Has(fsnotify.Write) || event.Has(fsnotify.Create) || event.Has(fsnotify.Rename) || event.Has(fsnotify.Remove) {
+				pendingMu.Lock()
+				pending[absolutePath(event.Name)] = true
+
+				// Cancel existing timer if any
+				if debounceTimer != nil {
+					debounceTimer.Stop()
+				}
+
+				// Set new timer
+				debounceTimer = time.AfterFunc(debounceDuration, regenerate)
+				pendingMu.Unlock()
+			}
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("Watcher error: %v", err)
+		}
+	}
+}
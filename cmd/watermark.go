@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// WatermarkConfig configures text drawn across every page of the generated PDFs
+type WatermarkConfig struct {
+	Text     string   `yaml:"text"`
+	Angle    *float64 `yaml:"angle,omitempty"`    // Degrees anti-clockwise (default: 45)
+	Opacity  *float64 `yaml:"opacity,omitempty"`  // 0.0 - 1.0 (default: 0.15)
+	Colour   string   `yaml:"colour,omitempty"`   // #RRGGBB (default: #808080)
+	FontSize *float64 `yaml:"fontSize,omitempty"` // Points (default: 60)
+}
+
+// pdfWatermark holds the resolved watermark settings
+type pdfWatermark struct {
+	text     string
+	angle    float64
+	opacity  float64
+	colour   rgbColor
+	fontSize float64
+}
+
+// resolveWatermark applies defaults to the configured watermark. When draft is set and no
+// watermark is configured, a "DRAFT" watermark is used. It returns nil if no watermark is needed.
+func resolveWatermark(config *Config, draft bool) (*pdfWatermark, error) {
+	settings := config.Watermark
+	if settings == nil || strings.TrimSpace(settings.Text) == "" {
+		if !draft {
+			return nil, nil
+		}
+		settings = &WatermarkConfig{Text: "DRAFT"}
+	}
+
+	watermark := &pdfWatermark{
+		text:     settings.Text,
+		angle:    45,
+		opacity:  0.15,
+		colour:   rgbColor{r: 128, g: 128, b: 128},
+		fontSize: 60,
+	}
+
+	if settings.Angle != nil {
+		watermark.angle = *settings.Angle
+	}
+	if settings.Opacity != nil {
+		if *settings.Opacity < 0 || *settings.Opacity > 1 {
+			return nil, fmt.Errorf("watermark opacity must be between 0 and 1")
+		}
+		watermark.opacity = *settings.Opacity
+	}
+	if strings.TrimSpace(settings.Colour) != "" {
+		colour, err := parseHexColor(settings.Colour)
+		if err != nil {
+			return nil, fmt.Errorf("invalid watermark colour '%s': %w", settings.Colour, err)
+		}
+		watermark.colour = *colour
+	}
+	if settings.FontSize != nil {
+		if *settings.FontSize <= 0 {
+			return nil, fmt.Errorf("watermark fontSize must be greater than 0")
+		}
+		watermark.fontSize = *settings.FontSize
+	}
+
+	return watermark, nil
+}
+
+// applyWatermark draws the watermark centred on every page. It is drawn when each page is
+// finished so that it sits on top of the song images rather than hidden behind them.
+func applyWatermark(pdf *gofpdf.Fpdf, watermark *pdfWatermark) {
+	if watermark == nil {
+		return
+	}
+
+	pdf.SetFooterFunc(func() {
+		pageWidth, pageHeight := pdf.GetPageSize()
+		centreX := pageWidth / 2
+		centreY := pageHeight / 2
+
+		pdf.SetFont("Arial", "B", watermark.fontSize)
+		pdf.SetTextColor(watermark.colour.r, watermark.colour.g, watermark.colour.b)
+		pdf.SetAlpha(watermark.opacity, "Normal")
+
+		textWidth := pdf.GetStringWidth(watermark.text)
+		_, fontHeight := pdf.GetFontSize()
+
+		pdf.TransformBegin()
+		pdf.TransformRotate(watermark.angle, centreX, centreY)
+		pdf.Text(centreX-textWidth/2, centreY+fontHeight/3, watermark.text)
+		pdf.TransformEnd()
+
+		pdf.SetAlpha(1, "Normal")
+		pdf.SetTextColor(0, 0, 0)
+	})
+}
+
+// draftStampText describes when the PDF was generated and which revision of the
+// source file it was generated from, e.g. "DRAFT - 2026-03-14 18:05 - gig.yaml @ 1a2b3c4 (modified)"
+func draftStampText(sourceFile string, generatedAt time.Time) string {
+	return fmt.Sprintf("DRAFT - %s - %s @ %s",
+		generatedAt.Format("2006-01-02 15:04"), filepath.Base(sourceFile), gitRevision(sourceFile))
+}
+
+// gitRevision returns the short hash of the last commit touching file, with "(modified)"
+// appended if the working copy differs from it
+func gitRevision(file string) string {
+	dir := filepath.Dir(file)
+	name := filepath.Base(file)
+
+	if _, err := os.Stat(file); err != nil {
+		return "unknown revision"
+	}
+
+	output, err := exec.Command("git", "-C", dir, "log", "-1", "--format=%h", "--", name).Output()
+	if err != nil {
+		return "not in git"
+	}
+	revision := strings.TrimSpace(string(output))
+	if revision == "" {
+		return "uncommitted"
+	}
+
+	status, err := exec.Command("git", "-C", dir, "status", "--porcelain", "--", name).Output()
+	if err == nil && strings.TrimSpace(string(status)) != "" {
+		revision += " (modified)"
+	}
+	return revision
+}
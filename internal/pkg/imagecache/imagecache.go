@@ -0,0 +1,191 @@
+package imagecache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	metaExt = ".json"
+	dataExt = ".img"
+)
+
+// cacheFileName matches the names of the files the cache writes: a key, as returned by Key,
+// with the metadata or data extension, and the temporary files these are written to first.
+// Other files in the cache directory are left alone.
+var cacheFileName = regexp.MustCompile(`^[0-9a-f]{64}(\.json|\.img)(\.[0-9]+\.tmp)?$`)
+
+// Cache stores prepared (cropped and encoded) images on disk, keyed by the
+// hash of the source file contents and the settings used to prepare them
+type Cache struct {
+	dir string
+}
+
+// Entry is a prepared image and the crop bounds that produced it
+type Entry struct {
+	ImageType string          `json:"imageType"` // gofpdf image type, e.g. "PNG" or "JPG"
+	Bounds    image.Rectangle `json:"bounds"`    // Crop bounds within the source image
+	Source    string          `json:"source"`    // Source path, for information only
+	Data      []byte          `json:"-"`         // Encoded image, stored alongside the metadata
+}
+
+// Stats summarises the contents of the cache
+type Stats struct {
+	Entries int
+	Bytes   int64
+	Oldest  time.Time
+	Newest  time.Time
+}
+
+// New returns a cache rooted at dir. The directory is created on first write.
+func New(dir string) *Cache {
+	return &Cache{dir: dir}
+}
+
+// Dir returns the directory holding the cache files
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// Key returns the cache key for a source file's contents and the settings used to prepare it
+func Key(content []byte, settings string) string {
+	contentHash := sha256.Sum256(content)
+	hash := sha256.New()
+	hash.Write(contentHash[:])
+	hash.Write([]byte{0})
+	hash.Write([]byte(settings))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Get returns the entry for key, or false if it is not cached or cannot be read
+func (c *Cache) Get(key string) (*Entry, bool) {
+	metaData, err := os.ReadFile(filepath.Join(c.dir, key+metaExt))
+	if err != nil {
+		return nil, false
+	}
+
+	var entry Entry
+	if err := json.Unmarshal(metaData, &entry); err != nil {
+		return nil, false
+	}
+
+	entry.Data, err = os.ReadFile(filepath.Join(c.dir, key+dataExt))
+	if err != nil {
+		return nil, false
+	}
+
+	return &entry, true
+}
+
+// Put stores entry under key. Files are written to a temporary name and renamed
+// so that concurrent runs never see a partially written entry.
+func (c *Cache) Put(key string, entry *Entry) error {
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	metaData, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache entry: %w", err)
+	}
+
+	// Write the data first so that a metadata file always has its data alongside
+	if err := writeFileAtomic(filepath.Join(c.dir, key+dataExt), entry.Data); err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(c.dir, key+metaExt), metaData)
+}
+
+// Stats returns the number of entries and total size of the cache
+func (c *Cache) Stats() (Stats, error) {
+	var stats Stats
+
+	files, err := os.ReadDir(c.dir)
+	if os.IsNotExist(err) {
+		return stats, nil
+	}
+	if err != nil {
+		return stats, fmt.Errorf("failed to read cache directory: %w", err)
+	}
+
+	for _, file := range files {
+		if file.IsDir() || !cacheFileName.MatchString(file.Name()) {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+
+		stats.Bytes += info.Size()
+		if strings.HasSuffix(file.Name(), metaExt) {
+			stats.Entries++
+			if stats.Oldest.IsZero() || info.ModTime().Before(stats.Oldest) {
+				stats.Oldest = info.ModTime()
+			}
+			if info.ModTime().After(stats.Newest) {
+				stats.Newest = info.ModTime()
+			}
+		}
+	}
+
+	return stats, nil
+}
+
+// Clean removes all cache entries, and any temporary files left by interrupted writes, and returns the number removed
+func (c *Cache) Clean() (int, error) {
+	files, err := os.ReadDir(c.dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read cache directory: %w", err)
+	}
+
+	removed := 0
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !cacheFileName.MatchString(name) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(c.dir, name)); err != nil {
+			return removed, fmt.Errorf("failed to remove %s: %w", name, err)
+		}
+		if strings.HasSuffix(name, metaExt) {
+			removed++
+		}
+	}
+
+	return removed, nil
+}
+
+func writeFileAtomic(filename string, data []byte) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create cache file: %w", err)
+	}
+	tmpName := tmpFile.Name()
+
+	if _, err := tmpFile.Write(data); err != nil {
+		_ = tmpFile.Close()
+		_ = os.Remove(tmpName)
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		_ = os.Remove(tmpName)
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	if err := os.Rename(tmpName, filename); err != nil {
+		_ = os.Remove(tmpName)
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	return nil
+}
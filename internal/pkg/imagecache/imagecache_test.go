@@ -0,0 +1,62 @@
+package imagecache
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCleanRemovesOnlyCacheFiles(t *testing.T) {
+	dir := t.TempDir()
+	cache := New(dir)
+
+	key := Key([]byte("chart"), "settings")
+	if err := cache.Put(key, &Entry{ImageType: "PNG", Bounds: image.Rect(0, 0, 10, 10), Data: []byte("data")}); err != nil {
+		t.Fatal(err)
+	}
+	leftover := key + dataExt + ".123456.tmp"
+	others := []string{"notes.json", "photo.img", "backup.tmp", "ABC" + metaExt, key[:63] + metaExt}
+	for _, name := range append([]string{leftover}, others...) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cacheFiles := []string{key + metaExt, key + dataExt, leftover}
+	var cacheBytes int64
+	for _, name := range cacheFiles {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cacheBytes += info.Size()
+	}
+
+	stats, err := cache.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Entries != 1 || stats.Bytes != cacheBytes {
+		t.Errorf("Stats = %d entries, %d bytes; want 1 entry, %d bytes", stats.Entries, stats.Bytes, cacheBytes)
+	}
+
+	removed, err := cache.Clean()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Errorf("Clean removed %d entries, want 1", removed)
+	}
+
+	for _, name := range cacheFiles {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s was not removed", name)
+		}
+	}
+	for _, name := range others {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s was removed, but is not a cache file", name)
+		}
+	}
+}
@@ -47,6 +47,15 @@ func getConfigPath() string {
 	return os.ExpandEnv(path)
 }
 
+// GetCachePath returns the folder used for cached data such as cropped images
+func GetCachePath() string {
+	path := os.Getenv("GIGSHEETS_CACHE_PATH")
+	if path != "" {
+		return path
+	}
+	return filepath.Join(getConfigPath(), "cache")
+}
+
 func GetLastUpdateCheck() time.Time {
 	EnsureInitialised()
 	return viper.GetTime("lastUpdateCheck")